@@ -0,0 +1,290 @@
+package rawhttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultBatchWorkers = 10
+)
+
+// BatchSpec is one line of a batch input file. Input files are JSONL: one
+// JSON object per line, blank lines are ignored.
+//
+//	{"id":"login-1","url":"https://example.com/login","ip":"10.0.0.1",
+//	 "raw":"POST /login HTTP/1.1\r\nHost: ||HOST||\r\n\r\nuser=||USER||",
+//	 "variables":{"USER":"admin"},"tags":["auth"]}
+//
+// Fields:
+//   - id: unique key used to match results and to resume a run. When empty,
+//     the 1-based line number of the spec is used.
+//   - url: absolute target URL, required.
+//   - ip: optional address to dial instead of resolving the URL host
+//     (Request.IP).
+//   - raw: the raw request. Template variables of the client's
+//     TransformRequestFunc (||HOST||, ||CLEN||, ...) are applied.
+//   - variables: values for ||NAME|| in raw, registered on the request
+//     with Request.SetVariables.
+//   - tags: free-form labels copied to the result.
+type BatchSpec struct {
+	ID        string            `json:"id,omitempty"`
+	URL       string            `json:"url"`
+	IP        string            `json:"ip,omitempty"`
+	Raw       string            `json:"raw"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+}
+
+// BatchResult is one line of a batch output file. Timings are in
+// milliseconds; body_sha256 is the hex SHA-256 of the decoded body.
+// error_class is a stable short name for the failure kind, see
+// BatchErrorClass. A body that could not be decoded or exceeded
+// MaxDecodedBytes keeps the status, headers and body fields along with the
+// error.
+type BatchResult struct {
+	ID              string              `json:"id"`
+	URL             string              `json:"url"`
+	Tags            []string            `json:"tags,omitempty"`
+	StatusCode      int                 `json:"status"`
+	Headers         map[string][]string `json:"headers,omitempty"`
+	BodyLength      int                 `json:"body_length"`
+	BodySHA256      string              `json:"body_sha256,omitempty"`
+	TimeToFirstByte float64             `json:"time_to_first_byte_ms"`
+	TimeToLastByte  float64             `json:"time_to_last_byte_ms"`
+	Error           string              `json:"error,omitempty"`
+	ErrorClass      string              `json:"error_class,omitempty"`
+}
+
+// BatchOptions configures RunBatch.
+type BatchOptions struct {
+	// Workers is the number of concurrent requests. Default: DefaultBatchWorkers.
+	Workers int
+	// NewClient creates the client used by one worker.
+	// Default: NewClientTransferVariables.
+	NewClient func() *Client
+	// Completed holds IDs that already have a result and must be skipped.
+	// Use CompletedBatchIDs to build it from a previous output file.
+	Completed map[string]bool
+}
+
+// RunBatch reads BatchSpec lines from in, sends them through a bounded pool
+// of workers and writes one BatchResult line per spec to out, in completion
+// order. Malformed spec lines produce a result with error_class
+// "invalid_spec". When ctx is cancelled no new specs are started, the
+// in-flight ones are finished and ctx.Err() is returned.
+func RunBatch(ctx context.Context, in io.Reader, out io.Writer, opts BatchOptions) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	newClient := opts.NewClient
+	if newClient == nil {
+		newClient = NewClientTransferVariables
+	}
+
+	specs := make(chan BatchSpec)
+	results := make(chan BatchResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := newClient()
+			defer client.Close()
+			for spec := range specs {
+				results <- runBatchSpec(client, spec)
+			}
+		}()
+	}
+
+	writeErr := make(chan error, 1)
+	go func() {
+		enc := json.NewEncoder(out)
+		var err error
+		for res := range results {
+			if err == nil {
+				err = enc.Encode(res)
+			}
+		}
+		writeErr <- err
+	}()
+
+	readErr := readBatchSpecs(ctx, in, opts.Completed, specs, results)
+	close(specs)
+	wg.Wait()
+	close(results)
+
+	if err := <-writeErr; err != nil {
+		return err
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return ctx.Err()
+}
+
+func readBatchSpecs(ctx context.Context, in io.Reader, completed map[string]bool, specs chan<- BatchSpec, results chan<- BatchResult) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var spec BatchSpec
+		err := json.Unmarshal([]byte(data), &spec)
+		if spec.ID == "" {
+			spec.ID = strconv.Itoa(line)
+		}
+		if completed[spec.ID] {
+			continue
+		}
+
+		if err != nil {
+			res := BatchResult{
+				ID:         spec.ID,
+				Error:      err.Error(),
+				ErrorClass: "invalid_spec",
+			}
+			select {
+			case results <- res:
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+
+		select {
+		case specs <- spec:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func runBatchSpec(client *Client, spec BatchSpec) BatchResult {
+	res := BatchResult{
+		ID:   spec.ID,
+		URL:  spec.URL,
+		Tags: spec.Tags,
+	}
+
+	req := &Request{
+		Rawdata: []byte(spec.Raw),
+		URL:     spec.URL,
+		IP:      spec.IP,
+	}
+	if len(spec.Variables) > 0 {
+		vars := NewVariables()
+		for k, v := range spec.Variables {
+			vars.Set(k, []byte(v))
+		}
+		req.SetVariables(vars)
+	}
+	resp := client.NewResponse()
+	err := client.Do(req, resp)
+	res.TimeToFirstByte = float64(resp.TimeToFirstByte) / float64(time.Millisecond)
+	res.TimeToLastByte = float64(resp.TimeToLastByte) / float64(time.Millisecond)
+	if err != nil {
+		res.Error = err.Error()
+		res.ErrorClass = BatchErrorClass(err)
+		return res
+	}
+
+	err = resp.ParseRawdata()
+	if err != nil && !resp.BodyError() {
+		res.Error = err.Error()
+		res.ErrorClass = "invalid_response"
+		return res
+	}
+	body := resp.Body()
+	sum := sha256.Sum256(body)
+	res.StatusCode = resp.StatusCode()
+	res.Headers = resp.Header()
+	res.BodyLength = len(body)
+	res.BodySHA256 = hex.EncodeToString(sum[:])
+	// the body could not be decoded or was cut at MaxDecodedBytes
+	if err != nil {
+		res.Error = err.Error()
+		res.ErrorClass = BatchErrorClass(err)
+	}
+	return res
+}
+
+// BatchErrorClass maps an error returned by Client.Do to a short, stable
+// class name: "invalid_url", "invalid_request", "timeout", "dns",
+// "connection_refused", "connection_reset", "eof", "tls", "proxy",
+// "content_encoding", "limit" or "other".
+func BatchErrorClass(err error) string {
+	var dnsErr *net.DNSError
+	var encErr *ContentEncodingError
+	var limitErr *LimitError
+	switch {
+	case errors.As(err, &encErr):
+		return "content_encoding"
+	case errors.As(err, &limitErr):
+		return "limit"
+	case errors.Is(err, InvalidURLError):
+		return "invalid_url"
+	case errors.Is(err, InvalidRequestError):
+		return "invalid_request"
+	case errors.Is(err, NetDNS) || errors.As(err, &dnsErr):
+		return "dns"
+	case isTimeoutError(err):
+		return "timeout"
+	case errors.Is(err, io.EOF):
+		return "eof"
+	case errors.Is(err, NetConnectRefused) || errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.Is(err, NetProxyRejected):
+		return "proxy"
+	case errors.Is(err, NetTLSHandshake):
+		return "tls"
+	}
+	var nerr *NetError
+	if errors.As(err, &nerr) && nerr.Phase == PhaseProxy {
+		return "proxy"
+	}
+	return "other"
+}
+
+// CompletedBatchIDs reads a previous batch output and returns the IDs that
+// already have a result. Results that failed without a response, such as
+// a timeout or a refused connection, do not count, so a resumed run sends
+// them again. Lines that cannot be decoded, such as a line cut short by an
+// interruption, are ignored.
+func CompletedBatchIDs(r io.Reader) (map[string]bool, error) {
+	done := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var res BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil || res.ID == "" {
+			continue
+		}
+		if res.ErrorClass != "" && res.StatusCode == 0 {
+			continue
+		}
+		done[res.ID] = true
+	}
+	return done, scanner.Err()
+}
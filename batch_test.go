@@ -0,0 +1,206 @@
+package rawhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func decodeBatchResults(t *testing.T, data []byte) map[string]BatchResult {
+	t.Helper()
+	results := make(map[string]BatchResult)
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var res BatchResult
+		if err := json.Unmarshal(line, &res); err != nil {
+			t.Fatalf("invalid result line %q: %v", line, err)
+		}
+		results[res.ID] = res
+	}
+	return results
+}
+
+func TestRunBatch(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nX-Test: yes\r\nContent-Length: 5\r\n\r\nhello"),
+		rawhttptest.Close(),
+	})
+	defer srv.Close()
+
+	specs := []BatchSpec{
+		{
+			ID:        "a",
+			URL:       srv.URL + "/a",
+			Raw:       "GET /||NAME|| HTTP/1.1\r\nHost: ||HOST||\r\n\r\n",
+			Variables: map[string]string{"NAME": "from-var"},
+			Tags:      []string{"t1"},
+		},
+		{
+			URL: srv.URL + "/b",
+			Raw: "GET /b HTTP/1.1\r\nHost: ||HOST||\r\n\r\n",
+		},
+	}
+	var in bytes.Buffer
+	for _, s := range specs {
+		line, _ := json.Marshal(s)
+		in.Write(line)
+		in.WriteString("\n\n")
+	}
+	in.WriteString("{not json\n")
+
+	var out bytes.Buffer
+	err := RunBatch(context.Background(), &in, &out, BatchOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("RunBatch() error: %v", err)
+	}
+
+	results := decodeBatchResults(t, out.Bytes())
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3:\n%s", len(results), out.String())
+	}
+
+	a := results["a"]
+	if a.StatusCode != 200 || a.BodyLength != 5 || a.Error != "" {
+		t.Errorf("result a = %+v", a)
+	}
+	if a.BodySHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("body_sha256 = %q", a.BodySHA256)
+	}
+	if len(a.Tags) != 1 || a.Tags[0] != "t1" {
+		t.Errorf("tags = %v, want [t1]", a.Tags)
+	}
+	if got := a.Headers["X-Test"]; len(got) != 1 || got[0] != "yes" {
+		t.Errorf("headers[X-Test] = %v", got)
+	}
+
+	// Line numbers are used for specs without an ID.
+	if results["3"].StatusCode != 200 {
+		t.Errorf("result 3 = %+v", results["3"])
+	}
+	if results["5"].ErrorClass != "invalid_spec" {
+		t.Errorf("result 5 = %+v, want invalid_spec", results["5"])
+	}
+
+	var sawVar bool
+	for _, c := range srv.Conns() {
+		if bytes.HasPrefix(c.Received(), []byte("GET /from-var ")) {
+			sawVar = true
+		}
+	}
+	if !sawVar {
+		t.Error("variables were not substituted in the sent request")
+	}
+}
+
+func TestRunBatch_BodyError(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: 7\r\n\r\nnotgzip"),
+	})
+	defer srv.Close()
+
+	spec, _ := json.Marshal(BatchSpec{ID: "a", URL: srv.URL + "/", Raw: "GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"})
+	var out bytes.Buffer
+	if err := RunBatch(context.Background(), bytes.NewReader(spec), &out, BatchOptions{}); err != nil {
+		t.Fatalf("RunBatch() error: %v", err)
+	}
+
+	a := decodeBatchResults(t, out.Bytes())["a"]
+	if a.StatusCode != 200 || a.BodyLength != 7 || a.Headers["Content-Encoding"] == nil {
+		t.Errorf("result = %+v, want the parsed response", a)
+	}
+	if a.ErrorClass != "content_encoding" || a.Error == "" {
+		t.Errorf("error = %q (%s), want content_encoding", a.Error, a.ErrorClass)
+	}
+}
+
+func TestRunBatch_SkipsCompleted(t *testing.T) {
+	in := strings.NewReader(`{"id":"done","url":"http://127.0.0.1:1/","raw":"GET / HTTP/1.1\r\n\r\n"}` + "\n" +
+		`{"id":"todo","url":"/relative","raw":"GET / HTTP/1.1\r\n\r\n"}` + "\n")
+
+	var out bytes.Buffer
+	err := RunBatch(context.Background(), in, &out, BatchOptions{
+		Completed: map[string]bool{"done": true},
+	})
+	if err != nil {
+		t.Fatalf("RunBatch() error: %v", err)
+	}
+
+	results := decodeBatchResults(t, out.Bytes())
+	if _, ok := results["done"]; ok {
+		t.Error("completed spec was run again")
+	}
+	if results["todo"].ErrorClass != "invalid_url" {
+		t.Errorf("result todo = %+v, want invalid_url", results["todo"])
+	}
+}
+
+func TestRunBatch_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	in := strings.NewReader(`{"id":"x","url":"http://127.0.0.1:1/","raw":"GET / HTTP/1.1\r\n\r\n"}` + "\n")
+	var out bytes.Buffer
+	err := RunBatch(ctx, in, &out, BatchOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("RunBatch() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCompletedBatchIDs(t *testing.T) {
+	data := `{"id":"a","url":"u","status":200}
+{"id":"b","url":"u","status":200,"error":"x","error_class":"content_encoding"}
+{"id":"c","url":"u","sta
+{"id":"d","url":"u","status":0,"error":"x","error_class":"timeout"}`
+
+	done, err := CompletedBatchIDs(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("CompletedBatchIDs() error: %v", err)
+	}
+	if !done["a"] || !done["b"] || done["c"] || done["d"] {
+		t.Errorf("CompletedBatchIDs() = %v, want a and b only", done)
+	}
+}
+
+func TestBatchErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"invalid url", InvalidURLError, "invalid_url"},
+		{"invalid request", fmt.Errorf("wrap: %w", InvalidRequestError), "invalid_request"},
+		{"dns", &net.DNSError{Err: "no such host", Name: "x"}, "dns"},
+		{"timeout", &timeoutError{}, "timeout"},
+		{"eof", io.EOF, "eof"},
+		{"refused", &NetError{Kind: NetConnectRefused, Err: syscall.ECONNREFUSED}, "connection_refused"},
+		{"reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, "connection_reset"},
+		{"tls", &NetError{Kind: NetTLSHandshake, Phase: PhaseTLS}, "tls"},
+		{"proxy rejected", &NetError{Kind: NetProxyRejected, StatusCode: 407}, "proxy"},
+		{"proxy connect", &NetError{Kind: NetConnect, Phase: PhaseProxy}, "proxy"},
+		{"stale eof", &NetError{Kind: NetStaleConn, Err: io.EOF}, "eof"},
+		{"content encoding", &ContentEncodingError{Encoding: "gzip", Err: io.ErrUnexpectedEOF}, "content_encoding"},
+		{"limit", &LimitError{Kind: LimitDecoded, Limit: 10}, "limit"},
+		{"other", errors.New("boom"), "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BatchErrorClass(tt.err); got != tt.want {
+				t.Errorf("BatchErrorClass() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
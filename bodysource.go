@@ -0,0 +1,115 @@
+package rawhttp
+
+import (
+	"io"
+)
+
+const (
+	DefaultSourceChunkSize = 32 << 10
+)
+
+// BodySource is a request body streamed to the connection after the
+// headers instead of being held in memory. The reader is consumed by the
+// first send, so a request with a source is sent once and is not retried
+// on a stale pooled connection. Clone does not copy the source.
+type BodySource struct {
+	Reader io.Reader
+	// Size is the length of the body, or -1 when unknown. A known size
+	// resolves ||CLEN|| and ||CLENHEX||; with an unknown size those markers
+	// are an error. The reader is not checked against it.
+	Size int64
+	// Chunked, when set, frames the body with chunked transfer-coding as
+	// it is read. Chunks hold ChunkSize or ChunkSizes bytes, default
+	// DefaultSourceChunkSize; the other options apply as in ChunkedEncode.
+	Chunked *ChunkedOptions
+}
+
+// SetBodySource replaces the body with src. A chunked source also sets
+// "Transfer-Encoding: chunked" and removes every Content-Length header, as
+// SetChunkedBody does.
+func (obj *Request) SetBodySource(src *BodySource) {
+	obj.ParseRawdata()
+	obj.body = nil
+	obj.bodySource = src
+	if src != nil && src.Chunked != nil {
+		for _, key := range obj.headerKeys("content-length") {
+			obj.DelHeader(key)
+		}
+		obj.SetHeader("transfer-encoding", []byte("Transfer-Encoding"), []byte("chunked"))
+	}
+}
+
+// BodySource returns the body source set by SetBodySource, or nil.
+func (obj *Request) BodySource() *BodySource {
+	return obj.bodySource
+}
+
+// WriteTo writes the request to w, streaming the body source when one is
+// set. Without a source it writes Bytes().
+func (obj *Request) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(obj.Bytes())
+	if err != nil || obj.bodySource == nil {
+		return int64(n), err
+	}
+	m, err := obj.bodySource.writeTo(w)
+	return int64(n) + m, err
+}
+
+func (obj *BodySource) writeTo(w io.Writer) (int64, error) {
+	if obj.Chunked == nil {
+		return io.Copy(w, obj.Reader)
+	}
+
+	var written int64
+	var buf []byte
+	for i := 0; ; i++ {
+		size := obj.chunkSize(i)
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		n, err := io.ReadFull(obj.Reader, buf[:size])
+		if n > 0 {
+			m, werr := w.Write(ChunkedEncode(buf[:n], obj.chunkOptions(i)))
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if obj.Chunked.OmitTerminator {
+		return written, nil
+	}
+	m, err := w.Write(ChunkedEncode(nil, *obj.Chunked))
+	return written + int64(m), err
+}
+
+func (obj *BodySource) chunkSize(i int) int {
+	opts := obj.Chunked
+	size := opts.ChunkSize
+	if len(opts.ChunkSizes) > 0 {
+		size = opts.ChunkSizes[min(i, len(opts.ChunkSizes)-1)]
+	}
+	if size <= 0 {
+		size = DefaultSourceChunkSize
+	}
+	return size
+}
+
+// chunkOptions returns the options that frame chunk i alone.
+func (obj *BodySource) chunkOptions(i int) ChunkedOptions {
+	opts := *obj.Chunked
+	opts.ChunkSize = 0
+	opts.ChunkSizes = nil
+	opts.OmitTerminator = true
+	if declared := obj.Chunked.DeclaredSize; declared != nil {
+		opts.DeclaredSize = func(_, n int) int { return declared(i, n) }
+	}
+	return opts
+}
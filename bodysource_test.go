@@ -0,0 +1,132 @@
+package rawhttp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestRequest_WriteTo_BodySource(t *testing.T) {
+	head := "POST /upload HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	tests := []struct {
+		name string
+		src  *BodySource
+		want string
+	}{
+		{
+			name: "plain",
+			src:  &BodySource{Reader: strings.NewReader("hello world"), Size: 11},
+			want: "POST /upload HTTP/1.1\r\nHost: example.com\r\n\r\nhello world",
+		},
+		{
+			name: "chunked",
+			src:  &BodySource{Reader: strings.NewReader("hello world"), Size: -1, Chunked: &ChunkedOptions{ChunkSize: 4}},
+			want: "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"4\r\nhell\r\n4\r\no wo\r\n3\r\nrld\r\n0\r\n\r\n",
+		},
+		{
+			name: "chunked sizes and trailers",
+			src: &BodySource{Reader: strings.NewReader("hello world"), Size: -1, Chunked: &ChunkedOptions{
+				ChunkSizes: []int{1, 5},
+				Trailers:   []string{"X-Sum: 1"},
+			}},
+			want: "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"1\r\nh\r\n5\r\nello \r\n5\r\nworld\r\n0\r\nX-Sum: 1\r\n\r\n",
+		},
+		{
+			name: "declared size gets the chunk index",
+			src: &BodySource{Reader: strings.NewReader("abcdef"), Size: -1, Chunked: &ChunkedOptions{
+				ChunkSize:      3,
+				DeclaredSize:   func(i, n int) int { return n + i },
+				OmitTerminator: true,
+			}},
+			want: "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"3\r\nabc\r\n4\r\ndef\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Rawdata: []byte(head)}
+			req.SetBodySource(tt.src)
+
+			var buf bytes.Buffer
+			n, err := req.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("WriteTo() wrote %q, want %q", buf.String(), tt.want)
+			}
+			if n != int64(buf.Len()) {
+				t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+			}
+		})
+	}
+}
+
+func TestRequest_BodySource_Bytes(t *testing.T) {
+	req := &Request{Rawdata: []byte("POST / HTTP/1.1\r\nHost: example.com\r\n\r\ninline")}
+	req.SetBodySource(&BodySource{Reader: strings.NewReader("streamed"), Size: 8})
+
+	if got, want := string(req.Bytes()), "POST / HTTP/1.1\r\nHost: example.com\r\n\r\n"; got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestRequest_BodySource_LengthMarkers(t *testing.T) {
+	raw := "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: ||CLEN||\r\nX-Hex: ||CLENHEX||\r\n\r\n"
+
+	req := &Request{Rawdata: []byte(raw)}
+	req.SetBodySource(&BodySource{Reader: strings.NewReader(""), Size: 300})
+	PrepareRequestVariables(req)
+	if req.prepareErr != nil {
+		t.Fatalf("prepareErr = %v", req.prepareErr)
+	}
+	want := "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 300\r\nX-Hex: 12c\r\n\r\n"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+
+	req = &Request{Rawdata: []byte(raw)}
+	req.SetBodySource(&BodySource{Reader: strings.NewReader(""), Size: -1})
+	PrepareRequestVariables(req)
+	var lerr *LengthMarkerError
+	if !errors.As(req.prepareErr, &lerr) {
+		t.Errorf("prepareErr = %v, want LengthMarkerError", req.prepareErr)
+	}
+}
+
+func TestClient_Do_BodySource(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.Expect("0\r\n\r\n"),
+		rawhttptest.Write("HTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n"),
+	})
+	defer srv.Close()
+
+	client := NewClientTransferVariables()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("PUT /f HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/f",
+	}
+	body := strings.Repeat("x", 100)
+	req.SetBodySource(&BodySource{Reader: strings.NewReader(body), Size: -1, Chunked: &ChunkedOptions{ChunkSize: 64}})
+
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	if resp.StatusCode() != 201 {
+		t.Errorf("StatusCode() = %d, want 201", resp.StatusCode())
+	}
+
+	want := "PUT /f HTTP/1.1\r\nHost: 127.0.0.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"40\r\n" + body[:64] + "\r\n24\r\n" + body[64:] + "\r\n0\r\n\r\n"
+	if got := string(srv.Conn(0).Received()); got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
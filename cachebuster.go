@@ -0,0 +1,197 @@
+package rawhttp
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/vodafon/vgutils"
+)
+
+// CacheBusterStrategy selects where a cache buster is placed.
+type CacheBusterStrategy int
+
+const (
+	// CacheBusterQuery appends "name=value" to the query.
+	CacheBusterQuery CacheBusterStrategy = iota
+	// CacheBusterHeader sets the header "Name: value".
+	CacheBusterHeader
+	// CacheBusterCookie appends "name=value" to the Cookie header.
+	CacheBusterCookie
+	// CacheBusterPathParam appends ";name=value" to the path.
+	CacheBusterPathParam
+	// CacheBusterAcceptLanguage appends the private-use language tag
+	// "x-value" to Accept-Language.
+	CacheBusterAcceptLanguage
+	// CacheBusterOrigin sets Origin to a subdomain of the target,
+	// "scheme://value.host". The host comes from URI, or else from the
+	// Host header with scheme https; with neither the buster is not
+	// placed.
+	CacheBusterOrigin
+)
+
+// CacheBuster is a unique value placed in a request so that it misses the
+// cache. Busters added with AddCacheBuster are recorded on the request, see
+// CacheBusters and CacheBusterTracker.
+type CacheBuster struct {
+	Strategy CacheBusterStrategy
+	// Name of the query parameter, header, cookie or path parameter.
+	// Default: "cb", or "X-Cache-Buster" for CacheBusterHeader. Unused by
+	// CacheBusterAcceptLanguage and CacheBusterOrigin.
+	Name string
+	// Value is the buster. Default: 8 random hex characters.
+	Value string
+}
+
+const (
+	DefaultCacheBusterName   = "cb"
+	DefaultCacheBusterHeader = "X-Cache-Buster"
+)
+
+// AddCacheBuster places a cache buster in a parsed request and records it.
+// It returns the buster with its defaults filled in.
+func (obj *Request) AddCacheBuster(cb CacheBuster) CacheBuster {
+	if cb.Value == "" {
+		cb.Value = vgutils.RandomHEXString(4)
+	}
+	if cb.Name == "" {
+		cb.Name = DefaultCacheBusterName
+		if cb.Strategy == CacheBusterHeader {
+			cb.Name = DefaultCacheBusterHeader
+		}
+	}
+
+	switch cb.Strategy {
+	case CacheBusterQuery:
+		obj.AddQueryParams([]byte(cb.Name + "=" + cb.Value))
+	case CacheBusterHeader:
+		obj.SetHeader(strings.ToLower(cb.Name), []byte(cb.Name), []byte(cb.Value))
+	case CacheBusterCookie:
+		obj.AddCookie(cb.Name, cb.Value)
+	case CacheBusterPathParam:
+		obj.addPathParam(cb.Name + "=" + cb.Value)
+	case CacheBusterAcceptLanguage:
+		obj.appendHeaderValue("accept-language", "Accept-Language", ", ", "x-"+cb.Value)
+	case CacheBusterOrigin:
+		scheme, host := obj.originTarget()
+		if host == "" {
+			return cb
+		}
+		obj.SetHeader("origin", []byte("Origin"), []byte(scheme+"://"+cb.Value+"."+host))
+	}
+	obj.cacheBusters = append(obj.cacheBusters, cb)
+	return cb
+}
+
+// originTarget returns the scheme and host an Origin buster is derived
+// from, an empty host when the request names none.
+func (obj *Request) originTarget() (string, string) {
+	if obj.URI != nil && obj.URI.Hostname() != "" {
+		return obj.URI.Scheme, obj.URI.Hostname()
+	}
+	host := strings.TrimSpace(string(obj.headers["host"].Value))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return "https", host
+}
+
+// CacheBusters returns the busters added to the request.
+func (obj *Request) CacheBusters() []CacheBuster {
+	return obj.cacheBusters
+}
+
+// AddCookie appends "name=value" to the Cookie header of a parsed request,
+// adding the header when it is missing.
+func (obj *Request) AddCookie(name, value string) {
+	obj.appendHeaderValue("cookie", "Cookie", "; ", name+"="+value)
+}
+
+// appendHeaderValue appends value to the header stored under key, or sets
+// the header when it is missing or empty.
+func (obj *Request) appendHeaderValue(key, name, sep, value string) {
+	hl, ok := obj.headers[key]
+	if !ok || len(hl.Value) == 0 {
+		obj.SetHeader(key, []byte(name), []byte(value))
+		return
+	}
+	obj.SetHeader(key, hl.Key, append(cloneBytes(hl.Value), sep+value...))
+}
+
+// addPathParam appends ";param" to the path, before the query and the
+// fragment.
+func (obj *Request) addPathParam(param string) {
+	end := bytes.IndexAny(obj.path, "?#")
+	if end == -1 {
+		end = len(obj.path)
+	}
+	var buf bytes.Buffer
+	buf.Write(obj.path[:end])
+	buf.WriteString(";" + param)
+	buf.Write(obj.path[end:])
+	obj.SetPath(buf.Bytes())
+}
+
+// CacheBusterTracker maps cache buster values to the requests carrying
+// them, so that responses, including reflected or cached ones, can be
+// matched to their request. It is safe for concurrent use.
+type CacheBusterTracker struct {
+	mu       sync.RWMutex
+	requests map[string]*Request
+}
+
+func NewCacheBusterTracker() *CacheBusterTracker {
+	return &CacheBusterTracker{requests: make(map[string]*Request)}
+}
+
+// Track records every cache buster of req.
+func (obj *CacheBusterTracker) Track(req *Request) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	if obj.requests == nil {
+		obj.requests = make(map[string]*Request)
+	}
+	for _, cb := range req.cacheBusters {
+		obj.requests[cb.Value] = req
+	}
+}
+
+// Lookup returns the request carrying the buster value.
+func (obj *CacheBusterTracker) Lookup(value string) (*Request, bool) {
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+	req, ok := obj.requests[value]
+	return req, ok
+}
+
+// Match returns the request whose buster appears first in the raw
+// response, or in the decoded body when the raw bytes do not contain any,
+// with the buster value.
+func (obj *CacheBusterTracker) Match(resp *Response) (*Request, string, bool) {
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+
+	if req, v, ok := obj.match(resp.Rawdata); ok {
+		return req, v, true
+	}
+	return obj.match(resp.Body())
+}
+
+func (obj *CacheBusterTracker) match(data []byte) (*Request, string, bool) {
+	var (
+		found *Request
+		value string
+		at    = -1
+	)
+	for v, req := range obj.requests {
+		idx := bytes.Index(data, []byte(v))
+		if idx == -1 {
+			continue
+		}
+		if at == -1 || idx < at || idx == at && len(v) > len(value) {
+			found, value, at = req, v, idx
+		}
+	}
+	return found, value, found != nil
+}
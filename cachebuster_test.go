@@ -0,0 +1,165 @@
+package rawhttp
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRequest_AddCacheBuster(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawdata string
+		cb      CacheBuster
+		want    string
+	}{
+		{
+			name:    "query",
+			rawdata: "GET /a?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterQuery, Value: "v1"},
+			want:    "GET /a?x=1&cb=v1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		},
+		{
+			name:    "header",
+			rawdata: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterHeader, Value: "v1"},
+			want:    "GET / HTTP/1.1\r\nHost: example.com\r\nX-Cache-Buster: v1\r\n\r\n",
+		},
+		{
+			name:    "named header",
+			rawdata: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterHeader, Name: "X-Forwarded-Scheme", Value: "v1"},
+			want:    "GET / HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-Scheme: v1\r\n\r\n",
+		},
+		{
+			name:    "new cookie",
+			rawdata: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterCookie, Value: "v1"},
+			want:    "GET / HTTP/1.1\r\nHost: example.com\r\nCookie: cb=v1\r\n\r\n",
+		},
+		{
+			name:    "existing cookie",
+			rawdata: "GET / HTTP/1.1\r\ncookie: a=1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterCookie, Value: "v1"},
+			want:    "GET / HTTP/1.1\r\ncookie: a=1; cb=v1\r\nHost: example.com\r\n\r\n",
+		},
+		{
+			name:    "path param",
+			rawdata: "GET /a/b?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterPathParam, Value: "v1"},
+			want:    "GET /a/b;cb=v1?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		},
+		{
+			name:    "accept language",
+			rawdata: "GET / HTTP/1.1\r\nAccept-Language: en-US\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterAcceptLanguage, Value: "v1"},
+			want:    "GET / HTTP/1.1\r\nAccept-Language: en-US, x-v1\r\n\r\n",
+		},
+		{
+			name:    "origin",
+			rawdata: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			cb:      CacheBuster{Strategy: CacheBusterOrigin, Value: "v1"},
+			want:    "GET / HTTP/1.1\r\nHost: example.com\r\nOrigin: https://v1.example.com\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Rawdata: []byte(tt.rawdata), URL: "https://example.com/"}
+			req.URI, _ = parseTestURL(req.URL)
+			if err := req.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error: %v", err)
+			}
+
+			got := req.AddCacheBuster(tt.cb)
+
+			if s := string(req.Bytes()); s != tt.want {
+				t.Errorf("Bytes() = %q, want %q", s, tt.want)
+			}
+			if bs := req.CacheBusters(); len(bs) != 1 || bs[0] != got {
+				t.Errorf("CacheBusters() = %v, want [%v]", bs, got)
+			}
+		})
+	}
+}
+
+func TestRequest_AddCacheBuster_Defaults(t *testing.T) {
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	a := req.AddCacheBuster(CacheBuster{})
+	b := req.AddCacheBuster(CacheBuster{})
+	if !regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(a.Value) || a.Name != DefaultCacheBusterName {
+		t.Errorf("buster = %+v", a)
+	}
+	if a.Value == b.Value {
+		t.Error("two busters with the same value")
+	}
+
+	req.CacheBusterParam()
+	if bs := req.CacheBusters(); len(bs) != 3 || bs[2].Name != bs[2].Value {
+		t.Errorf("CacheBusters() = %v", bs)
+	}
+}
+
+func TestRequest_AddCacheBuster_OriginWithoutURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawdata string
+		want    string
+	}{
+		{
+			name:    "host header",
+			rawdata: "GET / HTTP/1.1\r\nHost: target.test:8443\r\n\r\n",
+			want:    "GET / HTTP/1.1\r\nHost: target.test:8443\r\nOrigin: https://v1.target.test\r\n\r\n",
+		},
+		{
+			name:    "no host",
+			rawdata: "GET / HTTP/1.1\r\n\r\n",
+			want:    "GET / HTTP/1.1\r\n\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Rawdata: []byte(tt.rawdata)}
+			if err := req.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error: %v", err)
+			}
+			req.AddCacheBuster(CacheBuster{Strategy: CacheBusterOrigin, Value: "v1"})
+			if s := string(req.Bytes()); s != tt.want {
+				t.Errorf("Bytes() = %q, want %q", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheBusterTracker(t *testing.T) {
+	tracker := NewCacheBusterTracker()
+
+	reqs := make([]*Request, 3)
+	for i := range reqs {
+		reqs[i] = &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")}
+		reqs[i].ParseRawdata()
+		reqs[i].AddCacheBuster(CacheBuster{Strategy: CacheBusterHeader})
+		tracker.Track(reqs[i])
+	}
+
+	v := reqs[1].CacheBusters()[0].Value
+	if got, ok := tracker.Lookup(v); !ok || got != reqs[1] {
+		t.Errorf("Lookup(%q) = %p, %v", v, got, ok)
+	}
+	if _, ok := tracker.Lookup("missing"); ok {
+		t.Error("Lookup(missing) found a request")
+	}
+
+	resp := &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Length: 14\r\n\r\nhello " + v)}
+	if got, value, ok := tracker.Match(resp); !ok || got != reqs[1] || value != v {
+		t.Errorf("Match() = %p, %q, %v", got, value, ok)
+	}
+
+	resp = &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nno")}
+	if _, _, ok := tracker.Match(resp); ok {
+		t.Error("Match() found a request in an unrelated response")
+	}
+}
@@ -0,0 +1,226 @@
+// Package cachepoison probes a target for web cache poisoning through
+// unkeyed inputs. Each candidate input is sent with a unique canary in a
+// request isolated by a cache buster, then clean requests with the same
+// buster show whether the poisoned response was stored by the cache.
+package cachepoison
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vodafon/rawhttp"
+	"github.com/vodafon/vgutils"
+)
+
+// InputKind is where an input is placed in the request.
+type InputKind int
+
+const (
+	Header InputKind = iota
+	Query
+	Cookie
+)
+
+func (obj InputKind) String() string {
+	switch obj {
+	case Header:
+		return "header"
+	case Query:
+		return "query"
+	case Cookie:
+		return "cookie"
+	}
+	return fmt.Sprintf("InputKind(%d)", int(obj))
+}
+
+// CanaryPlaceholder in Input.Value is replaced with the probe canary.
+const CanaryPlaceholder = "{canary}"
+
+// Input is a candidate unkeyed input.
+type Input struct {
+	Kind InputKind
+	Name string
+	// Value sent for the input. CanaryPlaceholder is replaced with the
+	// canary. Default: the canary alone.
+	Value string
+}
+
+func (obj Input) String() string {
+	return obj.Kind.String() + ":" + obj.Name
+}
+
+// DefaultInputs returns headers that caches commonly leave out of the key.
+func DefaultInputs() []Input {
+	return []Input{
+		{Kind: Header, Name: "X-Forwarded-Host", Value: CanaryPlaceholder + ".example.com"},
+		{Kind: Header, Name: "X-Host", Value: CanaryPlaceholder + ".example.com"},
+		{Kind: Header, Name: "X-Forwarded-Server", Value: CanaryPlaceholder + ".example.com"},
+		{Kind: Header, Name: "X-Original-URL", Value: "/" + CanaryPlaceholder},
+		{Kind: Header, Name: "X-Rewrite-URL", Value: "/" + CanaryPlaceholder},
+		{Kind: Header, Name: "X-Forwarded-Scheme", Value: CanaryPlaceholder},
+		{Kind: Header, Name: "X-Forwarded-Proto", Value: CanaryPlaceholder},
+		{Kind: Header, Name: "X-Forwarded-Port", Value: CanaryPlaceholder},
+		{Kind: Header, Name: "X-Forwarded-Prefix", Value: "/" + CanaryPlaceholder},
+		{Kind: Header, Name: "Forwarded", Value: "host=" + CanaryPlaceholder + ".example.com"},
+		{Kind: Query, Name: "utm_content"},
+		{Kind: Query, Name: "callback"},
+	}
+}
+
+const (
+	DefaultFollowUps = 1
+)
+
+// Prober sends the probes. Target must be a parsed request with its URL
+// set; it is cloned for every request and never modified.
+type Prober struct {
+	// Client sends the requests. Default: a client from
+	// rawhttp.NewClientTransferVariables, closed when Run returns.
+	Client *rawhttp.Client
+	Target *rawhttp.Request
+	Inputs []Input
+	// FollowUps is the number of clean requests sent after each poisoned
+	// one. Default: DefaultFollowUps.
+	FollowUps int
+	// Delay is the pause before each clean request.
+	Delay time.Duration
+	// CacheBuster isolates the probes. Its Value is generated for every
+	// input; Strategy and Name are kept. Default: a query parameter.
+	CacheBuster rawhttp.CacheBuster
+	// NewCanary returns a unique marker for one input. Default: "cp"
+	// followed by 10 random hex characters.
+	NewCanary func() string
+}
+
+// Finding is the outcome of the probe for one input.
+type Finding struct {
+	Input  Input
+	Canary string
+	Buster rawhttp.CacheBuster
+	// Reflected is set when the canary appears in the poisoned response.
+	Reflected bool
+	// Persisted is set when the canary appears in a clean follow-up, so
+	// the poisoned response was served to a request without the input.
+	Persisted bool
+	// CacheHit is set when a follow-up was reported as a cache hit.
+	CacheHit  bool
+	Poisoned  *rawhttp.Response
+	FollowUps []*rawhttp.Response
+	Err       error
+}
+
+// Vulnerable reports whether the input poisoned the cache.
+func (obj Finding) Vulnerable() bool {
+	return obj.Persisted
+}
+
+// Run probes the inputs one at a time and returns one finding per input.
+// Transport errors are recorded in Finding.Err.
+func (obj *Prober) Run() []Finding {
+	client := obj.Client
+	if client == nil {
+		client = rawhttp.NewClientTransferVariables()
+		defer client.Close()
+	}
+
+	findings := make([]Finding, 0, len(obj.Inputs))
+	for _, input := range obj.Inputs {
+		findings = append(findings, obj.probe(client, input))
+	}
+	return findings
+}
+
+func (obj *Prober) probe(client *rawhttp.Client, input Input) Finding {
+	canary := obj.canary()
+	f := Finding{Input: input, Canary: canary}
+
+	base := obj.Target.Clone()
+	cb := obj.CacheBuster
+	cb.Value = ""
+	f.Buster = base.AddCacheBuster(cb)
+
+	poisoned := base.Clone()
+	inject(poisoned, input, canary)
+	f.Poisoned = rawhttp.NewResponse()
+	if f.Err = client.Do(poisoned, f.Poisoned); f.Err != nil {
+		return f
+	}
+	f.Reflected = contains(f.Poisoned, canary)
+
+	followUps := obj.FollowUps
+	if followUps <= 0 {
+		followUps = DefaultFollowUps
+	}
+	for i := 0; i < followUps; i++ {
+		time.Sleep(obj.Delay)
+		resp := rawhttp.NewResponse()
+		if f.Err = client.Do(base.Clone(), resp); f.Err != nil {
+			return f
+		}
+		f.FollowUps = append(f.FollowUps, resp)
+		if contains(resp, canary) {
+			f.Persisted = true
+		}
+		if CacheStatusOf(resp).Hit {
+			f.CacheHit = true
+		}
+	}
+	return f
+}
+
+func (obj *Prober) canary() string {
+	if obj.NewCanary != nil {
+		return obj.NewCanary()
+	}
+	return "cp" + vgutils.RandomHEXString(5)
+}
+
+func inject(req *rawhttp.Request, input Input, canary string) {
+	value := input.Value
+	if value == "" {
+		value = CanaryPlaceholder
+	}
+	value = strings.ReplaceAll(value, CanaryPlaceholder, canary)
+
+	switch input.Kind {
+	case Header:
+		req.SetHeader(strings.ToLower(input.Name), []byte(input.Name), []byte(value))
+	case Query:
+		req.AddQueryParams([]byte(input.Name + "=" + value))
+	case Cookie:
+		req.AddCookie(input.Name, value)
+	}
+}
+
+// contains reports whether the canary is in the raw response or in its
+// decoded body.
+func contains(resp *rawhttp.Response, canary string) bool {
+	return bytes.Contains(resp.Rawdata, []byte(canary)) || bytes.Contains(resp.Body(), []byte(canary))
+}
+
+// WriteReport writes one line per finding, vulnerable inputs first.
+func WriteReport(w io.Writer, findings []Finding) error {
+	for _, pass := range []bool{true, false} {
+		for _, f := range findings {
+			if f.Vulnerable() != pass {
+				continue
+			}
+			status := "clean"
+			switch {
+			case f.Err != nil:
+				status = "error: " + f.Err.Error()
+			case f.Persisted:
+				status = "POISONED"
+			case f.Reflected:
+				status = "reflected"
+			}
+			if _, err := fmt.Fprintf(w, "%-40s %-10s cache_hit=%t buster=%s\n", f.Input, status, f.CacheHit, f.Buster.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
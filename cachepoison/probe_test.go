@@ -0,0 +1,130 @@
+package cachepoison
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp"
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func reply(headers, body string) rawhttptest.Script {
+	return rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write(fmt.Sprintf("HTTP/1.1 200 OK\r\n%sContent-Length: %d\r\n\r\n%s", headers, len(body), body)),
+	}
+}
+
+func TestProber_Run(t *testing.T) {
+	srv := rawhttptest.NewServer(
+		// X-Forwarded-Host: reflected, then served from cache
+		reply("X-Cache: MISS\r\n", `<script src="//canary1.example.com/a.js">`),
+		reply("X-Cache: HIT\r\nAge: 3\r\n", `<script src="//canary1.example.com/a.js">`),
+		// X-Other: reflected, not cached
+		reply("X-Cache: MISS\r\n", "canary2"),
+		reply("X-Cache: MISS\r\n", "clean"),
+		// utm_content: not reflected
+		reply("", "clean"),
+		reply("", "clean"),
+	)
+	defer srv.Close()
+
+	client := rawhttp.NewDefaultClient()
+	client.DisableKeepAlive = true
+	defer client.Close()
+
+	target := &rawhttp.Request{
+		Rawdata: []byte("GET /page HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/page",
+	}
+	if err := target.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	n := 0
+	p := &Prober{
+		Client: client,
+		Target: target,
+		Inputs: []Input{
+			{Kind: Header, Name: "X-Forwarded-Host", Value: CanaryPlaceholder + ".example.com"},
+			{Kind: Header, Name: "X-Other"},
+			{Kind: Query, Name: "utm_content"},
+		},
+		CacheBuster: rawhttp.CacheBuster{Strategy: rawhttp.CacheBusterQuery, Name: "buster"},
+		NewCanary: func() string {
+			n++
+			return fmt.Sprintf("canary%d", n)
+		},
+	}
+	findings := p.Run()
+
+	if len(findings) != 3 {
+		t.Fatalf("len(findings) = %d, want 3", len(findings))
+	}
+	want := []struct{ reflected, persisted, hit bool }{
+		{true, true, true},
+		{true, false, false},
+		{false, false, false},
+	}
+	for i, f := range findings {
+		if f.Err != nil {
+			t.Fatalf("finding %d error: %v", i, f.Err)
+		}
+		if f.Reflected != want[i].reflected || f.Persisted != want[i].persisted || f.CacheHit != want[i].hit {
+			t.Errorf("finding %d (%s) = reflected %v persisted %v hit %v, want %+v",
+				i, f.Input, f.Reflected, f.Persisted, f.CacheHit, want[i])
+		}
+	}
+
+	poisoned := string(srv.Conn(0).Received())
+	clean := string(srv.Conn(1).Received())
+	buster := "buster=" + findings[0].Buster.Value
+	if !strings.Contains(poisoned, "X-Forwarded-Host: canary1.example.com\r\n") || !strings.Contains(poisoned, buster) {
+		t.Errorf("poisoned request = %q", poisoned)
+	}
+	if strings.Contains(clean, "X-Forwarded-Host") || !strings.Contains(clean, buster) {
+		t.Errorf("clean request = %q", clean)
+	}
+	if q := string(srv.Conn(4).Received()); !strings.Contains(q, "utm_content=canary3") {
+		t.Errorf("query request = %q", q)
+	}
+	if target.CacheBusters() != nil {
+		t.Error("Target was modified")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, findings); err != nil {
+		t.Fatalf("WriteReport() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "header:X-Forwarded-Host") || !strings.Contains(lines[0], "POISONED") {
+		t.Errorf("report = %q", buf.String())
+	}
+}
+
+func TestProber_Run_DefaultClient(t *testing.T) {
+	ok := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nclean"
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write(ok),
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write(ok),
+	})
+	defer srv.Close()
+
+	target := &rawhttp.Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	if err := target.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	p := &Prober{Target: target, Inputs: []Input{{Kind: Header, Name: "X-Forwarded-Host"}}, FollowUps: 1}
+	findings := p.Run()
+	if len(findings) != 1 || findings[0].Err != nil || len(findings[0].FollowUps) != 1 {
+		t.Errorf("findings = %+v, want one clean finding", findings)
+	}
+}
@@ -0,0 +1,85 @@
+package cachepoison
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vodafon/rawhttp"
+)
+
+// CacheStatus is what the response headers tell about the cache.
+type CacheStatus struct {
+	// Known is set when at least one cache header was found.
+	Known bool
+	// Hit is set when a header reports the response was served from cache.
+	Hit bool
+	// Headers holds the cache headers that were found.
+	Headers http.Header
+}
+
+// cacheStatusHeaders report HIT or MISS, possibly with a prefix such as
+// "TCP_HIT" or a list such as "HIT, MISS" for stacked caches.
+var cacheStatusHeaders = []string{
+	"X-Cache",
+	"X-Cache-Status",
+	"X-Proxy-Cache",
+	"X-Nginx-Cache",
+	"X-Drupal-Cache",
+	"X-Varnish-Cache",
+	"X-Cache-Lookup",
+	"X-Litespeed-Cache",
+	"CF-Cache-Status",
+	"Akamai-Cache-Status",
+	"CDN-Cache",
+}
+
+// CacheStatusOf inspects Age, Cache-Status (RFC 9211), X-Cache, X-Varnish,
+// X-Cache-Hits, CF-Cache-Status and similar headers.
+func CacheStatusOf(resp *rawhttp.Response) CacheStatus {
+	st := CacheStatus{Headers: http.Header{}}
+	h := resp.Header()
+	if h == nil {
+		return st
+	}
+	found := func(name string) (string, bool) {
+		v := h.Get(name)
+		if v == "" {
+			return "", false
+		}
+		st.Known = true
+		st.Headers[http.CanonicalHeaderKey(name)] = h.Values(name)
+		return v, true
+	}
+
+	if v, ok := found("Age"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			st.Hit = true
+		}
+	}
+	for _, name := range cacheStatusHeaders {
+		if v, ok := found(name); ok && strings.Contains(strings.ToUpper(v), "HIT") {
+			st.Hit = true
+		}
+	}
+	if v, ok := found("Cache-Status"); ok {
+		for _, member := range strings.Split(v, ",") {
+			for _, param := range strings.Split(member, ";")[1:] {
+				if strings.EqualFold(strings.TrimSpace(param), "hit") {
+					st.Hit = true
+				}
+			}
+		}
+	}
+	if v, ok := found("X-Varnish"); ok && len(strings.Fields(v)) > 1 {
+		st.Hit = true
+	}
+	if v, ok := found("X-Cache-Hits"); ok {
+		for _, f := range strings.Split(v, ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(f)); err == nil && n > 0 {
+				st.Hit = true
+			}
+		}
+	}
+	return st
+}
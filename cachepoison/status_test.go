@@ -0,0 +1,40 @@
+package cachepoison
+
+import (
+	"testing"
+
+	"github.com/vodafon/rawhttp"
+)
+
+func TestCacheStatusOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		headers   string
+		wantKnown bool
+		wantHit   bool
+	}{
+		{"no cache headers", "Server: x\r\n", false, false},
+		{"age zero", "Age: 0\r\n", true, false},
+		{"age", "Age: 12\r\n", true, true},
+		{"x-cache miss", "X-Cache: MISS\r\n", true, false},
+		{"x-cache stacked hit", "X-Cache: MISS, HIT\r\n", true, true},
+		{"akamai", "X-Cache: TCP_MEM_HIT from a1\r\n", true, true},
+		{"cloudflare dynamic", "CF-Cache-Status: DYNAMIC\r\n", true, false},
+		{"cloudflare hit", "CF-Cache-Status: HIT\r\n", true, true},
+		{"cache-status miss", "Cache-Status: ExampleCache; fwd=miss; stored\r\n", true, false},
+		{"cache-status hit", "Cache-Status: Origin; fwd=miss, CDN; hit; ttl=30\r\n", true, true},
+		{"varnish miss", "X-Varnish: 1234\r\n", true, false},
+		{"varnish hit", "X-Varnish: 1234 5678\r\n", true, true},
+		{"cache hits", "X-Cache-Hits: 0, 3\r\n", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &rawhttp.Response{Rawdata: []byte("HTTP/1.1 200 OK\r\n" + tt.headers + "Content-Length: 0\r\n\r\n")}
+			st := CacheStatusOf(resp)
+			if st.Known != tt.wantKnown || st.Hit != tt.wantHit {
+				t.Errorf("CacheStatusOf() = %+v, want Known=%v Hit=%v", st, tt.wantKnown, tt.wantHit)
+			}
+		})
+	}
+}
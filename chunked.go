@@ -0,0 +1,120 @@
+package rawhttp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChunkedOptions controls how ChunkedEncode frames a body. The zero value
+// produces a well-formed encoding with the whole body in one chunk.
+// Several options deliberately produce malformed framing for testing
+// parsers.
+type ChunkedOptions struct {
+	// ChunkSize splits the body into chunks of this size. Ignored when
+	// ChunkSizes is set. Default: the whole body in one chunk.
+	ChunkSize int
+	// ChunkSizes gives the size of each chunk in order. The last size is
+	// repeated for the rest of the body.
+	ChunkSizes []int
+	// Extensions are appended to every chunk size line, e.g. "a=b" gives
+	// "5;a=b". They are written as is, without validation.
+	Extensions []string
+	// UppercaseHex writes sizes as "1A" instead of "1a".
+	UppercaseHex bool
+	// LeadingZeros pads chunk sizes with zeros to this width.
+	LeadingZeros int
+	// Trailers are raw header lines written after the last chunk.
+	Trailers []string
+	// BareLF ends lines with "\n" instead of "\r\n".
+	BareLF bool
+	// DeclaredSize, when set, returns the size written for chunk i whose
+	// real length is n. Returning a value other than n gives oversized,
+	// undersized or negative sizes. The terminating chunk is not passed.
+	DeclaredSize func(i, n int) int
+	// OmitTerminator leaves out the last zero-size chunk, the trailers and
+	// the final empty line.
+	OmitTerminator bool
+}
+
+// ChunkedEncode returns body framed with chunked transfer-coding.
+func ChunkedEncode(body []byte, opts ChunkedOptions) []byte {
+	eol := "\r\n"
+	if opts.BareLF {
+		eol = "\n"
+	}
+
+	var buf bytes.Buffer
+	for i, chunk := range opts.split(body) {
+		size := len(chunk)
+		if opts.DeclaredSize != nil {
+			size = opts.DeclaredSize(i, size)
+		}
+		opts.writeSizeLine(&buf, size, eol)
+		buf.Write(chunk)
+		buf.WriteString(eol)
+	}
+	if opts.OmitTerminator {
+		return buf.Bytes()
+	}
+
+	opts.writeSizeLine(&buf, 0, eol)
+	for _, t := range opts.Trailers {
+		buf.WriteString(t)
+		buf.WriteString(eol)
+	}
+	buf.WriteString(eol)
+	return buf.Bytes()
+}
+
+func (obj ChunkedOptions) split(body []byte) [][]byte {
+	var chunks [][]byte
+	for i := 0; len(body) > 0; i++ {
+		size := len(body)
+		switch {
+		case len(obj.ChunkSizes) > 0:
+			size = obj.ChunkSizes[min(i, len(obj.ChunkSizes)-1)]
+		case obj.ChunkSize > 0:
+			size = obj.ChunkSize
+		}
+		if size <= 0 || size > len(body) {
+			size = len(body)
+		}
+		chunks = append(chunks, body[:size])
+		body = body[size:]
+	}
+	return chunks
+}
+
+func (obj ChunkedOptions) writeSizeLine(buf *bytes.Buffer, size int, eol string) {
+	s := strconv.FormatInt(int64(size), 16)
+	if obj.UppercaseHex {
+		s = strings.ToUpper(s)
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if pad := obj.LeadingZeros - len(s); pad > 0 {
+		s = strings.Repeat("0", pad) + s
+	}
+	if neg {
+		s = "-" + s
+	}
+	buf.WriteString(s)
+	for _, ext := range obj.Extensions {
+		fmt.Fprintf(buf, ";%s", ext)
+	}
+	buf.WriteString(eol)
+}
+
+// SetChunkedBody replaces the body of a parsed request with its chunked
+// encoding, sets "Transfer-Encoding: chunked" and removes every
+// Content-Length header. The body is sent verbatim, so BareLF framing and
+// "||" in the data survive the client's template processing.
+func (obj *Request) SetChunkedBody(body []byte, opts ChunkedOptions) {
+	obj.setRawBody(ChunkedEncode(body, opts))
+	for _, key := range obj.headerKeys("content-length") {
+		obj.DelHeader(key)
+	}
+	obj.SetHeader("transfer-encoding", []byte("Transfer-Encoding"), []byte("chunked"))
+}
@@ -0,0 +1,150 @@
+package rawhttp
+
+import (
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestChunkedEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		opts ChunkedOptions
+		want string
+	}{
+		{
+			name: "single chunk",
+			body: "hello",
+			want: "5\r\nhello\r\n0\r\n\r\n",
+		},
+		{
+			name: "empty body",
+			body: "",
+			want: "0\r\n\r\n",
+		},
+		{
+			name: "fixed chunk size",
+			body: "hello world",
+			opts: ChunkedOptions{ChunkSize: 4},
+			want: "4\r\nhell\r\n4\r\no wo\r\n3\r\nrld\r\n0\r\n\r\n",
+		},
+		{
+			name: "size distribution repeats last",
+			body: "abcdefghij",
+			opts: ChunkedOptions{ChunkSizes: []int{1, 3}},
+			want: "1\r\na\r\n3\r\nbcd\r\n3\r\nefg\r\n3\r\nhij\r\n0\r\n\r\n",
+		},
+		{
+			name: "extensions",
+			body: "abc",
+			opts: ChunkedOptions{Extensions: []string{"a=b", "c"}},
+			want: "3;a=b;c\r\nabc\r\n0;a=b;c\r\n\r\n",
+		},
+		{
+			name: "uppercase hex with leading zeros",
+			body: "abcdefghijklmnopqrstuvwxyz",
+			opts: ChunkedOptions{UppercaseHex: true, LeadingZeros: 4},
+			want: "001A\r\nabcdefghijklmnopqrstuvwxyz\r\n0000\r\n\r\n",
+		},
+		{
+			name: "trailers",
+			body: "abc",
+			opts: ChunkedOptions{Trailers: []string{"X-Sum: 1", "X-Other: 2"}},
+			want: "3\r\nabc\r\n0\r\nX-Sum: 1\r\nX-Other: 2\r\n\r\n",
+		},
+		{
+			name: "bare LF",
+			body: "abc",
+			opts: ChunkedOptions{BareLF: true},
+			want: "3\nabc\n0\n\n",
+		},
+		{
+			name: "oversized and negative sizes",
+			body: "abcdef",
+			opts: ChunkedOptions{ChunkSize: 3, LeadingZeros: 2, DeclaredSize: func(i, n int) int {
+				if i == 0 {
+					return n + 16
+				}
+				return -n
+			}},
+			want: "13\r\nabc\r\n-03\r\ndef\r\n00\r\n\r\n",
+		},
+		{
+			name: "missing terminator",
+			body: "abc",
+			opts: ChunkedOptions{OmitTerminator: true, Trailers: []string{"X: 1"}},
+			want: "3\r\nabc\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(ChunkedEncode([]byte(tt.body), tt.opts)); got != tt.want {
+				t.Errorf("ChunkedEncode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetChunkedBody(t *testing.T) {
+	req := &Request{Rawdata: []byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 3\r\n" +
+		"X-A: 1\r\nContent-Length: 4\r\nX-B: 2\r\n\r\nabc")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	req.SetChunkedBody([]byte("hello"), ChunkedOptions{ChunkSize: 2})
+
+	want := "POST / HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\nX-B: 2\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"2\r\nhe\r\n2\r\nll\r\n1\r\no\r\n0\r\n\r\n"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestClient_Do_ChunkedBodyVerbatim(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Expect("0\n\n"),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("POST / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+	req.SetChunkedBody([]byte("a||HOST||"), ChunkedOptions{BareLF: true})
+
+	if err := client.Do(req, &Response{}); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	want := "POST / HTTP/1.1\r\nHost: 127.0.0.1\r\nTransfer-Encoding: chunked\r\n\r\n9\na||HOST||\n0\n\n"
+	if got := string(srv.Conn(0).Received()); got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestDelHeader(t *testing.T) {
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	req.DelHeader("b")
+	req.DelHeader("missing")
+	req.SetHeader("d", []byte("D"), []byte("4"))
+
+	want := "GET / HTTP/1.1\r\nA: 1\r\nC: 3\r\nD: 4\r\n\r\n"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
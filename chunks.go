@@ -0,0 +1,244 @@
+package rawhttp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Chunk is one chunk of a chunked response body as it was received,
+// including the terminating zero-size chunk.
+type Chunk struct {
+	// Offset is the position of the size line in Rawdata, DataOffset the
+	// position of the chunk data.
+	Offset     int
+	DataOffset int
+	// DeclaredSize is the size from the size line, -1 when it is not a
+	// valid hex number.
+	DeclaredSize int64
+	// Size is the number of data bytes found before the line end. It
+	// differs from DeclaredSize when the framing is wrong.
+	Size int
+	// Extensions are the raw parts after ";" on the size line.
+	Extensions []string
+}
+
+// ChunkAnomalyKind classifies a ChunkAnomaly.
+type ChunkAnomalyKind int
+
+const (
+	// ChunkInvalidSize: the size line is not a hex number. Parsing stops.
+	ChunkInvalidSize ChunkAnomalyKind = iota
+	// ChunkSizeMismatch: the data is not followed by a line end at the
+	// declared size. Parsing resumes after the next line end.
+	ChunkSizeMismatch
+	// ChunkBareLF: a line ends with "\n" instead of "\r\n".
+	ChunkBareLF
+	// ChunkIncomplete: the body ends before the last chunk, the trailers or
+	// the final empty line.
+	ChunkIncomplete
+	// ChunkTrailingData: bytes follow the end of the chunked body, e.g. a
+	// second response.
+	ChunkTrailingData
+)
+
+func (obj ChunkAnomalyKind) String() string {
+	switch obj {
+	case ChunkInvalidSize:
+		return "invalid size"
+	case ChunkSizeMismatch:
+		return "size mismatch"
+	case ChunkBareLF:
+		return "bare LF"
+	case ChunkIncomplete:
+		return "incomplete"
+	case ChunkTrailingData:
+		return "trailing data"
+	}
+	return fmt.Sprintf("ChunkAnomalyKind(%d)", int(obj))
+}
+
+// ChunkAnomaly is a framing error in a chunked body.
+type ChunkAnomaly struct {
+	Kind ChunkAnomalyKind
+	// Chunk is the index of the chunk in Chunks, -1 for the trailers and
+	// the data after the body.
+	Chunk int
+	// Offset is the position in Rawdata.
+	Offset int
+}
+
+func (obj ChunkAnomaly) String() string {
+	return fmt.Sprintf("%s at %d (chunk %d)", obj.Kind, obj.Offset, obj.Chunk)
+}
+
+// chunkedLayout is the result of parsing a chunked body.
+type chunkedLayout struct {
+	chunks    []Chunk
+	trailer   http.Header
+	anomalies []ChunkAnomaly
+}
+
+// Chunks returns the chunks of a chunked response, nil otherwise.
+func (obj *Response) Chunks() []Chunk {
+	return obj.chunked().chunks
+}
+
+// Trailer returns the trailer fields of a chunked response.
+func (obj *Response) Trailer() http.Header {
+	return obj.chunked().trailer
+}
+
+// ChunkAnomalies returns the framing errors of a chunked response.
+func (obj *Response) ChunkAnomalies() []ChunkAnomaly {
+	return obj.chunked().anomalies
+}
+
+func (obj *Response) chunked() *chunkedLayout {
+	if obj.chunkLayout != nil {
+		return obj.chunkLayout
+	}
+	obj.ParseRawdata()
+	obj.chunkLayout = &chunkedLayout{}
+	head := obj.Rawdata[obj.headOffset:]
+	size := headerSize(head)
+	if size == -1 || !obj.hasBody() || !isChunked(head[:size]) {
+		return obj.chunkLayout
+	}
+	start := obj.headOffset + size + 1
+	if head[size] == '\r' {
+		start++
+	}
+	obj.chunkLayout = parseChunked(obj.Rawdata, start)
+	return obj.chunkLayout
+}
+
+// isChunked reports whether chunked is the last transfer coding of the raw
+// response head. net/http removes Transfer-Encoding from the parsed header.
+func isChunked(head []byte) bool {
+	var codings []string
+	for _, line := range bytes.Split(head, []byte("\n"))[1:] {
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if ok && strings.EqualFold(string(bytes.TrimSpace(name)), "Transfer-Encoding") {
+			codings = append(codings, strings.Split(string(value), ",")...)
+		}
+	}
+	return len(codings) > 0 && strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+}
+
+// parseChunked parses the chunked body of data starting at pos.
+func parseChunked(data []byte, pos int) *chunkedLayout {
+	l := &chunkedLayout{trailer: http.Header{}}
+	anomaly := func(kind ChunkAnomalyKind, chunk, offset int) {
+		l.anomalies = append(l.anomalies, ChunkAnomaly{Kind: kind, Chunk: chunk, Offset: offset})
+	}
+	// line returns the line at pos and the position after it
+	line := func(pos, chunk int) ([]byte, int, bool) {
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i == -1 {
+			anomaly(ChunkIncomplete, chunk, len(data))
+			return nil, 0, false
+		}
+		ln := data[pos : pos+i]
+		if !bytes.HasSuffix(ln, []byte("\r")) {
+			anomaly(ChunkBareLF, chunk, pos+i)
+		}
+		return bytes.TrimSuffix(ln, []byte("\r")), pos + i + 1, true
+	}
+
+	for {
+		idx := len(l.chunks)
+		sizeLine, next, ok := line(pos, idx)
+		if !ok {
+			return l
+		}
+		c := Chunk{Offset: pos, DataOffset: next}
+		sizePart, ext, _ := bytes.Cut(sizeLine, []byte(";"))
+		if len(ext) > 0 {
+			for _, e := range strings.Split(string(ext), ";") {
+				c.Extensions = append(c.Extensions, strings.TrimSpace(e))
+			}
+		}
+		c.DeclaredSize = parseChunkSize(sizePart)
+		if c.DeclaredSize == -1 {
+			l.chunks = append(l.chunks, c)
+			anomaly(ChunkInvalidSize, idx, pos)
+			return l
+		}
+		pos = next
+
+		if c.DeclaredSize == 0 {
+			l.chunks = append(l.chunks, c)
+			break
+		}
+
+		// the data ends at the declared size when a line end follows; a
+		// bare LF only counts when the data holds no CRLF, which more
+		// likely ends a shorter chunk
+		end := pos + int(min(c.DeclaredSize, int64(len(data)-pos)))
+		if int64(len(data)-pos) >= c.DeclaredSize && (bytes.HasPrefix(data[end:], []byte("\r\n")) ||
+			bytes.HasPrefix(data[end:], []byte("\n")) && !bytes.Contains(data[pos:end], []byte("\r\n"))) {
+			c.Size = int(c.DeclaredSize)
+			if data[end] == '\n' {
+				anomaly(ChunkBareLF, idx, end)
+				pos = end + 1
+			} else {
+				pos = end + 2
+			}
+			l.chunks = append(l.chunks, c)
+			continue
+		}
+
+		// the data does not end at the declared size; take it up to the
+		// next line end
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i == -1 {
+			c.Size = len(data) - pos
+			l.chunks = append(l.chunks, c)
+			anomaly(ChunkIncomplete, idx, len(data))
+			return l
+		}
+		c.Size = i
+		if i > 0 && data[pos+i-1] == '\r' {
+			c.Size--
+		}
+		l.chunks = append(l.chunks, c)
+		anomaly(ChunkSizeMismatch, idx, pos+c.Size)
+		pos += i + 1
+	}
+
+	for {
+		ln, next, ok := line(pos, -1)
+		if !ok {
+			return l
+		}
+		pos = next
+		if len(ln) == 0 {
+			break
+		}
+		if k, v, ok := bytes.Cut(ln, []byte(":")); ok {
+			l.trailer.Add(textproto.TrimString(string(k)), textproto.TrimString(string(v)))
+		}
+	}
+	if pos < len(data) {
+		anomaly(ChunkTrailingData, -1, pos)
+	}
+	return l
+}
+
+// parseChunkSize parses a hex chunk size with optional surrounding spaces
+// or tabs, returning -1 when it is invalid.
+func parseChunkSize(b []byte) int64 {
+	s := strings.Trim(string(b), " \t")
+	if s == "" || s[0] == '+' || s[0] == '-' {
+		return -1
+	}
+	n, err := strconv.ParseInt(s, 16, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
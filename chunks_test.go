@@ -0,0 +1,119 @@
+package rawhttp
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestResponse_Chunks(t *testing.T) {
+	head := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+	base := len(head)
+
+	tests := []struct {
+		name          string
+		body          string
+		wantChunks    []Chunk
+		wantTrailer   http.Header
+		wantAnomalies []ChunkAnomaly
+	}{
+		{
+			name: "well formed",
+			body: "3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 3, DeclaredSize: 3, Size: 3},
+				{Offset: base + 8, DataOffset: base + 11, DeclaredSize: 2, Size: 2},
+				{Offset: base + 15, DataOffset: base + 18, DeclaredSize: 0},
+			},
+			wantTrailer: http.Header{},
+		},
+		{
+			name: "extensions and trailers",
+			body: "3;name=value; flag\r\nabc\r\n0;last\r\nX-Checksum: abc\r\nX-Other:  1 \r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 20, DeclaredSize: 3, Size: 3, Extensions: []string{"name=value", "flag"}},
+				{Offset: base + 25, DataOffset: base + 33, DeclaredSize: 0, Extensions: []string{"last"}},
+			},
+			wantTrailer: http.Header{"X-Checksum": {"abc"}, "X-Other": {"1"}},
+		},
+		{
+			name: "declared size too small",
+			body: "2\r\nabcd\r\n0\r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 3, DeclaredSize: 2, Size: 4},
+				{Offset: base + 9, DataOffset: base + 12, DeclaredSize: 0},
+			},
+			wantTrailer:   http.Header{},
+			wantAnomalies: []ChunkAnomaly{{Kind: ChunkSizeMismatch, Chunk: 0, Offset: base + 7}},
+		},
+		{
+			name: "declared size too large",
+			body: "9\r\nabc\r\n0\r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 3, DeclaredSize: 9, Size: 3},
+				{Offset: base + 8, DataOffset: base + 11, DeclaredSize: 0},
+			},
+			wantTrailer:   http.Header{},
+			wantAnomalies: []ChunkAnomaly{{Kind: ChunkSizeMismatch, Chunk: 0, Offset: base + 6}},
+		},
+		{
+			name: "bare LF",
+			body: "3\nabc\n0\r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 2, DeclaredSize: 3, Size: 3},
+				{Offset: base + 6, DataOffset: base + 9, DeclaredSize: 0},
+			},
+			wantTrailer: http.Header{},
+			wantAnomalies: []ChunkAnomaly{
+				{Kind: ChunkBareLF, Chunk: 0, Offset: base + 1},
+				{Kind: ChunkBareLF, Chunk: 0, Offset: base + 5},
+			},
+		},
+		{
+			name: "invalid size",
+			body: "zz\r\nabc\r\n0\r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 4, DeclaredSize: -1},
+			},
+			wantAnomalies: []ChunkAnomaly{{Kind: ChunkInvalidSize, Chunk: 0, Offset: base}},
+		},
+		{
+			name: "missing last chunk",
+			body: "3\r\nabc\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 3, DeclaredSize: 3, Size: 3},
+			},
+			wantAnomalies: []ChunkAnomaly{{Kind: ChunkIncomplete, Chunk: 1, Offset: base + 8}},
+		},
+		{
+			name: "trailing response",
+			body: "0\r\n\r\nHTTP/1.1 200 OK\r\n\r\n",
+			wantChunks: []Chunk{
+				{Offset: base, DataOffset: base + 3, DeclaredSize: 0},
+			},
+			wantTrailer:   http.Header{},
+			wantAnomalies: []ChunkAnomaly{{Kind: ChunkTrailingData, Chunk: -1, Offset: base + 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Rawdata: []byte(head + tt.body)}
+			if got := resp.Chunks(); !reflect.DeepEqual(got, tt.wantChunks) {
+				t.Errorf("Chunks() = %+v, want %+v", got, tt.wantChunks)
+			}
+			if got := resp.Trailer(); !reflect.DeepEqual(got, tt.wantTrailer) && (len(got) > 0 || len(tt.wantTrailer) > 0) {
+				t.Errorf("Trailer() = %v, want %v", got, tt.wantTrailer)
+			}
+			if got := resp.ChunkAnomalies(); !reflect.DeepEqual(got, tt.wantAnomalies) {
+				t.Errorf("ChunkAnomalies() = %v, want %v", got, tt.wantAnomalies)
+			}
+		})
+	}
+}
+
+func TestResponse_Chunks_NotChunked(t *testing.T) {
+	resp := &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\n3\r\n")}
+	if resp.Chunks() != nil || resp.Trailer() != nil || resp.ChunkAnomalies() != nil {
+		t.Errorf("chunk layout of a non-chunked response: %v %v %v", resp.Chunks(), resp.Trailer(), resp.ChunkAnomalies())
+	}
+}
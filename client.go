@@ -3,6 +3,7 @@ package rawhttp
 import (
 	"bytes"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -29,6 +30,10 @@ type Client struct {
 	Timeout              time.Duration
 	proxyURI             *url.URL
 
+	// Variables holds custom template variables available to every
+	// request sent by this client. See SetVariable.
+	Variables *Variables
+
 	// Connection pooling
 	pool             *ConnPool
 	DisableKeepAlive bool
@@ -39,6 +44,27 @@ type Client struct {
 	// The read loop resets this timer each time data is received.
 	// Total read time is still bounded by Timeout.
 	QuietTimeout time.Duration
+
+	// StreamRetainBytes caps the raw bytes DoStream keeps in
+	// Response.Rawdata. Default: DefaultStreamRetainBytes. A negative value
+	// keeps everything.
+	StreamRetainBytes int
+
+	// MaxResponseBytes caps the raw bytes read for one response, and
+	// MaxHeaderBytes its status line and headers. A response exceeding a
+	// limit is cut there, marked Truncated, and Do returns a *LimitError.
+	// DoStream returns it for the headers, and from the stream for the
+	// body. Zero means no limit.
+	MaxResponseBytes int
+	MaxHeaderBytes   int
+
+	// MaxDecodedBytes is copied to Response.MaxDecodedBytes when the
+	// response has no limit of its own.
+	MaxDecodedBytes int
+
+	// Retry makes Do repeat failed exchanges. The zero value does not
+	// retry.
+	Retry RetryPolicy
 }
 
 const (
@@ -55,6 +81,25 @@ func (obj *Client) SetProxy(u *url.URL) {
 	obj.proxyURI = u
 }
 
+// SetVariable registers a fixed-value template variable, ||name||, for all
+// requests sent by the client.
+func (obj *Client) SetVariable(name string, value []byte) {
+	obj.variables().Set(name, value)
+}
+
+// SetVariableFunc registers a computed template variable for all requests
+// sent by the client.
+func (obj *Client) SetVariableFunc(name string, fn VariableFunc) {
+	obj.variables().SetFunc(name, fn)
+}
+
+func (obj *Client) variables() *Variables {
+	if obj.Variables == nil {
+		obj.Variables = NewVariables()
+	}
+	return obj.Variables
+}
+
 func NewDefaultClient() *Client {
 	return &Client{
 		TransformRequestFunc: PrepareRequest,
@@ -110,17 +155,41 @@ func (obj *Client) Close() {
 	}
 }
 
+// Do sends req and reads the response into resp, repeating the exchange as
+// Retry allows. Every exchange is recorded in resp.Attempts.
 func (obj *Client) Do(req *Request, resp *Response) error {
-	var err error
-	req.URI, err = url.Parse(req.URL)
-	if err != nil {
+	resp.Request = req
+	if err := obj.prepare(req); err != nil {
 		return err
 	}
-	if !req.URI.IsAbs() {
-		return InvalidURLError
+
+	retry := obj.Retry.retryable(req)
+	var attempts []Attempt
+	var delay time.Duration
+	for n := 1; ; n++ {
+		start := time.Now()
+		err := obj.do(req, resp)
+		attempt := Attempt{Delay: delay, Duration: time.Since(start), Err: err}
+		if err == nil {
+			attempt.StatusCode = resp.StatusCode()
+		}
+		attempts = append(attempts, attempt)
+
+		var again bool
+		if retry {
+			delay, again = obj.Retry.next(n, resp, err)
+		}
+		if !again {
+			resp.Attempts = attempts
+			return err
+		}
+		time.Sleep(delay)
+		resp.Reset()
 	}
-	req.ParseRawdata()
-	obj.TransformRequestFunc(req)
+}
+
+// do performs one exchange of a prepared request.
+func (obj *Client) do(req *Request, resp *Response) error {
 	if bytes.HasPrefix(req.Rawdata, []byte("CONNECT ")) {
 		return obj.DoProxy(req, resp)
 	}
@@ -139,6 +208,25 @@ func (obj *Client) Do(req *Request, resp *Response) error {
 	}
 }
 
+// prepare parses the URL and applies TransformRequestFunc.
+func (obj *Client) prepare(req *Request) error {
+	var err error
+	req.URI, err = url.Parse(req.URL)
+	if err != nil {
+		return err
+	}
+	if !req.URI.IsAbs() {
+		return InvalidURLError
+	}
+	req.ParseRawdata()
+	req.clientVariables = obj.Variables
+	obj.TransformRequestFunc(req)
+	if req.prepareErr != nil {
+		return fmt.Errorf("%w: %w", InvalidRequestError, req.prepareErr)
+	}
+	return nil
+}
+
 func (obj *Client) httpDialer() proxy.Dialer {
 	return httpDialer{
 		Timeout: obj.Timeout,
@@ -152,27 +240,27 @@ func (obj *Client) httpsDialer() proxy.Dialer {
 }
 
 func (obj *Client) DoWithProxy(req *Request, resp *Response) error {
-	port := req.URI.Port()
-
-	if req.URI.Scheme == "https" {
-		if port == "" {
-			port = "443"
-		}
-	} else {
-		if port == "" {
-			port = "80"
-		}
+	conn, err := obj.dialProxy(req)
+	if err != nil {
+		return err
 	}
+	return obj.DoConn(conn, req, resp)
+}
+
+// dialProxy connects to the request target through the client proxy and
+// performs the TLS handshake for https URLs.
+func (obj *Client) dialProxy(req *Request) (net.Conn, error) {
 	forward := obj.httpDialer()
 
 	proxy, err := ProxyFromURL(obj.proxyURI, forward)
 	if err != nil {
-		return fmt.Errorf("ProxyFromURL error: %w", err)
+		return nil, fmt.Errorf("%w: proxy: %w", InvalidURLError, err)
 	}
 
-	conn, err := proxy.Dial("tcp", req.Addr(port))
+	addr := req.Addr(req.port())
+	conn, err := proxy.Dial("tcp", addr)
 	if err != nil {
-		return err
+		return nil, netError(PhaseProxy, obj.proxyURI.Host, err)
 	}
 
 	if req.URI.Scheme == "https" {
@@ -182,14 +270,15 @@ func (obj *Client) DoWithProxy(req *Request, resp *Response) error {
 		})
 		if err := tlsConn.Handshake(); err != nil {
 			conn.Close()
-			return fmt.Errorf("TLS handshake through proxy error: %w", err)
+			return nil, netError(PhaseTLS, addr, err)
 		}
-		return obj.DoConn(tlsConn, req, resp)
+		return tlsConn, nil
 	}
-	return obj.DoConn(conn, req, resp)
+	return conn, nil
 }
 
 func (obj *Client) DoHTTPS(req *Request, resp *Response) error {
+	resp.Request = req
 	port := req.URI.Port()
 	if port == "" {
 		port = "443"
@@ -197,33 +286,32 @@ func (obj *Client) DoHTTPS(req *Request, resp *Response) error {
 
 	poolKey := PoolKey("https", req.URI.Hostname(), port)
 
-	// Try pooled connection first
-	if obj.pool != nil && !obj.DisableKeepAlive {
+	// Try pooled connection first. A body source is read only once, so it
+	// is not risked on a pooled connection that may be stale.
+	var stale error
+	if obj.pool != nil && !obj.DisableKeepAlive && req.bodySource == nil {
 		if conn := obj.pool.Get(poolKey); conn != nil {
-			err := obj.doConnWithPool(conn, req, resp, poolKey)
-			if err == nil {
-				return nil
-			}
-			// If stale connection error, close and retry with fresh connection
-			if isStaleConnError(err) {
-				conn.Close()
-				resp.Reset()
-				// Fall through to dial fresh connection
-			} else {
-				return err // Real error, don't retry
+			err := staleConnError(obj.doConnWithPool(conn, req, resp, poolKey))
+			if !errors.Is(err, NetStaleConn) {
+				return err // Success or a real error, don't retry
 			}
+			// Stale connection: retry with fresh connection
+			stale = err
+			conn.Close()
+			resp.Reset()
 		}
 	}
 
 	// Dial fresh connection
 	conn, err := obj.httpsDialer().Dial("tcp", req.Addr(port))
 	if err != nil {
-		return err
+		return redialError(stale, err)
 	}
 	return obj.doConnWithPool(conn, req, resp, poolKey)
 }
 
 func (obj *Client) DoHTTP(req *Request, resp *Response) error {
+	resp.Request = req
 	port := req.URI.Port()
 	if port == "" {
 		port = "80"
@@ -231,28 +319,26 @@ func (obj *Client) DoHTTP(req *Request, resp *Response) error {
 
 	poolKey := PoolKey("http", req.URI.Hostname(), port)
 
-	// Try pooled connection first
-	if obj.pool != nil && !obj.DisableKeepAlive {
+	// Try pooled connection first. A body source is read only once, so it
+	// is not risked on a pooled connection that may be stale.
+	var stale error
+	if obj.pool != nil && !obj.DisableKeepAlive && req.bodySource == nil {
 		if conn := obj.pool.Get(poolKey); conn != nil {
-			err := obj.doConnWithPool(conn, req, resp, poolKey)
-			if err == nil {
-				return nil
-			}
-			// If stale connection error, close and retry with fresh connection
-			if isStaleConnError(err) {
-				conn.Close()
-				resp.Reset()
-				// Fall through to dial fresh connection
-			} else {
-				return err // Real error, don't retry
+			err := staleConnError(obj.doConnWithPool(conn, req, resp, poolKey))
+			if !errors.Is(err, NetStaleConn) {
+				return err // Success or a real error, don't retry
 			}
+			// Stale connection: retry with fresh connection
+			stale = err
+			conn.Close()
+			resp.Reset()
 		}
 	}
 
 	// Dial fresh connection
 	conn, err := obj.httpDialer().Dial("tcp", req.Addr(port))
 	if err != nil {
-		return err
+		return redialError(stale, err)
 	}
 	return obj.doConnWithPool(conn, req, resp, poolKey)
 }
@@ -272,35 +358,40 @@ func (obj *Client) DoProxy(req *Request, resp *Response) error {
 			port = "80"
 		}
 	}
-	var conn net.Conn
-	var err error
+	addr := req.Addr(port)
+	dialer := obj.httpDialer()
 	if req.URI.Scheme == "https" {
-		dialer := &net.Dialer{Timeout: obj.Timeout}
-		conn, err = tls.DialWithDialer(dialer, "tcp", req.Addr(port), &tls.Config{
-			InsecureSkipVerify: true,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		conn, err = net.DialTimeout("tcp", req.Addr(port), obj.Timeout)
-		if err != nil {
-			return err
-		}
+		dialer = obj.httpsDialer()
 	}
-	if _, err := conn.Write(req.Rawdata); err != nil {
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
 		return err
 	}
+	if _, err := conn.Write(req.Rawdata); err != nil {
+		conn.Close()
+		return netError(PhaseProxy, addr, err)
+	}
 	buf := make([]byte, 1<<21) // 2Mb
 	n, err := conn.Read(buf)
 	if err != nil && err != io.EOF {
-		return err
+		conn.Close()
+		return netError(PhaseProxy, addr, err)
 	}
 	if !bytes.Contains(buf, []byte("200")) {
-		return fmt.Errorf("can not connect to proxy. resp: %q", buf[:n])
+		conn.Close()
+		return &NetError{
+			Kind:       NetProxyRejected,
+			Phase:      PhaseProxy,
+			Addr:       addr,
+			StatusCode: statusCodeOf(buf[:n]),
+			Err:        fmt.Errorf("can not connect to proxy. resp: %q", buf[:n]),
+		}
 	}
 	req.Rawdata = bytes.Join(parts[1:], []byte("\r\n"))
-	return obj.DoConn(conn, req, resp)
+	// the response answers the tunnelled request, not the CONNECT
+	resp.Request = &Request{Rawdata: req.Rawdata}
+	defer conn.Close()
+	return obj.doConnInternal(conn, req, resp)
 }
 
 // DoConn performs the HTTP request on the given connection and always closes it.
@@ -308,6 +399,7 @@ func (obj *Client) DoProxy(req *Request, resp *Response) error {
 // reuse is not desired (e.g., proxy connections).
 func (obj *Client) DoConn(conn net.Conn, req *Request, resp *Response) error {
 	defer conn.Close()
+	resp.Request = req
 	return obj.doConnInternal(conn, req, resp)
 }
 
@@ -346,12 +438,17 @@ func (obj *Client) doConnWithPool(conn net.Conn, req *Request, resp *Response, p
 // (indicating a stale/closed connection rather than a valid empty response).
 func (obj *Client) doConnInternal(conn net.Conn, req *Request, resp *Response) error {
 	// fmt.Printf("===DEBUG=== RAW:\n%q\n", req.Bytes())
-	if _, err := conn.Write(req.Bytes()); err != nil {
-		return err
+	addr := req.Addr(req.port())
+	if _, err := req.WriteTo(conn); err != nil {
+		return netError(PhaseWrite, addr, err)
 	}
 
 	writeTime := time.Now() // Start timing after write completes
 
+	if resp.MaxDecodedBytes == 0 {
+		resp.MaxDecodedBytes = obj.MaxDecodedBytes
+	}
+
 	quietTimeout := obj.QuietTimeout
 	if quietTimeout == 0 {
 		quietTimeout = DefaultQuietTimeout
@@ -388,6 +485,9 @@ func (obj *Client) doConnInternal(conn net.Conn, req *Request, resp *Response) e
 			receivedData = true
 			// fmt.Printf("===REC===: %q\n", buf[:n])
 			resp.Rawdata = append(resp.Rawdata, buf[:n]...)
+			if err := obj.checkReadLimits(resp); err != nil {
+				return err
+			}
 			// Data received - continue reading (quiet timer resets on next iteration)
 			continue
 		}
@@ -397,7 +497,7 @@ func (obj *Client) doConnInternal(conn net.Conn, req *Request, resp *Response) e
 			if isTimeoutError(err) {
 				if !receivedData {
 					// Phase 1 timeout - no response within Timeout
-					return err
+					return netError(PhaseRead, addr, err)
 				}
 				// Phase 2 timeout (QuietTimeout) - response complete
 				return nil
@@ -410,37 +510,22 @@ func (obj *Client) doConnInternal(conn net.Conn, req *Request, resp *Response) e
 					return nil
 				}
 				// EOF with no data - connection was closed (stale connection)
-				return err
+				return netError(PhaseRead, addr, err)
 			}
 
 			if strings.HasSuffix(err.Error(), "tls: user canceled") {
 				return nil
 			}
-			return err
+			return netError(PhaseRead, addr, err)
 		}
 	}
 }
 
 // isTimeoutError checks if the error is a network timeout error.
 func isTimeoutError(err error) bool {
-	if netErr, ok := err.(net.Error); ok {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
 		return netErr.Timeout()
 	}
 	return false
 }
-
-// isStaleConnError returns true if the error indicates a stale/closed connection
-// that may have been valid when pooled but is no longer usable.
-// This helps detect connections closed by the server due to keep-alive timeout.
-func isStaleConnError(err error) bool {
-	if err == nil {
-		return false
-	}
-	if err == io.EOF {
-		return true
-	}
-	errStr := err.Error()
-	return strings.Contains(errStr, "broken pipe") ||
-		strings.Contains(errStr, "connection reset") ||
-		strings.Contains(errStr, "use of closed network connection")
-}
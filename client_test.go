@@ -2,10 +2,15 @@ package rawhttp
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
 )
 
 func TestNewDefaultClient(t *testing.T) {
@@ -223,19 +228,29 @@ func TestIsStaleConnError(t *testing.T) {
 		},
 		{
 			name:     "broken pipe",
-			err:      errors.New("write: broken pipe"),
+			err:      &net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)},
 			wantBool: true,
 		},
 		{
 			name:     "connection reset",
-			err:      errors.New("read: connection reset by peer"),
+			err:      &NetError{Kind: NetRead, Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}},
 			wantBool: true,
 		},
 		{
 			name:     "use of closed network connection",
-			err:      errors.New("use of closed network connection"),
+			err:      fmt.Errorf("read: %w", net.ErrClosed),
+			wantBool: true,
+		},
+		{
+			name:     "wrapped EOF",
+			err:      &NetError{Kind: NetRead, Err: io.EOF},
 			wantBool: true,
 		},
+		{
+			name:     "error text only",
+			err:      errors.New("write: broken pipe"),
+			wantBool: false,
+		},
 		{
 			name:     "other error",
 			err:      errors.New("some other error"),
@@ -310,6 +325,296 @@ func TestInvalidRequestError(t *testing.T) {
 	}
 }
 
+func TestClient_DoHTTP(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("GET /path HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/path",
+	}
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		t.Errorf("StatusCode() = %d, want 200", resp.StatusCode())
+	}
+	if string(resp.Body()) != "hello" {
+		t.Errorf("Body() = %q, want %q", resp.Body(), "hello")
+	}
+	if resp.TimeToFirstByte <= 0 || resp.TimeToLastByte < resp.TimeToFirstByte {
+		t.Errorf("timings = %v / %v", resp.TimeToFirstByte, resp.TimeToLastByte)
+	}
+
+	want := "GET /path HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n"
+	if got := string(srv.Conn(0).Received()); got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestClient_DoHTTP_Head(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("HEAD / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if resp.Request != req {
+		t.Error("Request is not set")
+	}
+	if resp.StatusCode() != 200 || len(resp.Body()) != 0 {
+		t.Errorf("response = %d %q, want 200 without body", resp.StatusCode(), resp.Body())
+	}
+}
+
+func TestClient_DoProxy_TunnelledResponse(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.Expect("\r\n\r\n"),
+		rawhttptest.Write("HTTP/1.1 200 Connection established\r\n\r\n"),
+		rawhttptest.Expect("GET /inner"),
+		rawhttptest.Expect("\r\n\r\n"),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("CONNECT example.com:80 HTTP/1.1\r\nHost: example.com:80\r\n\r\n" +
+			"GET /inner HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		URL: srv.URL + "/",
+	}
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if string(resp.Body()) != "hello" || len(resp.Extra()) != 0 {
+		t.Errorf("Body() = %q, Extra() = %q, want the tunnelled body", resp.Body(), resp.Extra())
+	}
+}
+
+func TestClient_DoConn_GarbageReply(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("garbage"),
+		rawhttptest.Close(),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: srv.URL + "/"}
+	if err := client.prepare(req); err != nil {
+		t.Fatalf("prepare() error: %v", err)
+	}
+	conn, err := net.Dial("tcp", srv.URL[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &Response{}
+	if err := client.DoConn(conn, req, resp); err != nil {
+		t.Fatalf("DoConn() error: %v", err)
+	}
+
+	if resp.Request != req {
+		t.Error("Request is not linked to the response")
+	}
+	if resp.IsHTTP09() || resp.ParseRawdata() == nil {
+		t.Errorf("response %q parsed as HTTP/0.9, want a parse error", resp.Rawdata)
+	}
+}
+
+func TestClient_DoHTTP09(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.Expect("\r\n"),
+		rawhttptest.Write("<html>0.9</html>"),
+		rawhttptest.Close(),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{Rawdata: []byte("GET /\r\n"), URL: srv.URL + "/"}
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if !resp.IsHTTP09() || string(resp.Body()) != "<html>0.9</html>" {
+		t.Errorf("response = %q", resp.Rawdata)
+	}
+	if got := string(srv.Conn(0).Received()); got != "GET /\r\n" {
+		t.Errorf("server received %q", got)
+	}
+}
+
+func TestClient_DoHTTPS(t *testing.T) {
+	srv := rawhttptest.NewTLSServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if resp.StatusCode() != 201 {
+		t.Errorf("StatusCode() = %d, want 201", resp.StatusCode())
+	}
+}
+
+func TestClient_DoHTTP_KeepAliveReuse(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none"),
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\ntwo"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	for _, want := range []string{"one", "two"} {
+		req := &Request{
+			Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+			URL:     srv.URL + "/",
+		}
+		resp := &Response{}
+		if err := client.Do(req, resp); err != nil {
+			t.Fatalf("Do() error: %v", err)
+		}
+		if string(resp.Body()) != want {
+			t.Errorf("Body() = %q, want %q", resp.Body(), want)
+		}
+	}
+
+	if n := len(srv.Conns()); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestClient_DoHTTP_StalePooledConnection(t *testing.T) {
+	srv := rawhttptest.NewServer(
+		rawhttptest.Script{
+			rawhttptest.ExpectRequest(),
+			rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfirst"),
+			rawhttptest.Sleep(20 * time.Millisecond),
+			rawhttptest.Close(),
+		},
+		rawhttptest.Script{
+			rawhttptest.ExpectRequest(),
+			rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfresh"),
+		},
+	)
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	send := func() *Response {
+		req := &Request{
+			Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+			URL:     srv.URL + "/",
+		}
+		resp := &Response{}
+		if err := client.Do(req, resp); err != nil {
+			t.Fatalf("Do() error: %v", err)
+		}
+		return resp
+	}
+
+	send()
+	srv.Conn(0).Wait()
+
+	if got := string(send().Body()); got != "fresh" {
+		t.Errorf("Body() = %q, want %q", got, "fresh")
+	}
+}
+
+func TestClient_DoHTTP_SplitResponse(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.WriteSlow("HTTP/1.1 200 OK\r\n", time.Millisecond),
+		rawhttptest.Write("Content-Length: 4\r\n\r\nab"),
+		rawhttptest.Sleep(2 * time.Millisecond),
+		rawhttptest.Write("cd"),
+		rawhttptest.Close(),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+	// the gaps between the writes must not end the read on a slow machine
+	client.QuietTimeout = 5 * time.Second
+
+	req := &Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if string(resp.Body()) != "abcd" {
+		t.Errorf("Body() = %q, want %q", resp.Body(), "abcd")
+	}
+}
+
+func TestClient_DoHTTP_NoResponseTimeout(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Sleep(200 * time.Millisecond),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClientTimeout(50 * time.Millisecond)
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	err := client.Do(req, &Response{})
+	if !isTimeoutError(err) {
+		t.Errorf("Do() error = %v, want timeout", err)
+	}
+}
+
 // Mock timeout error for testing
 type timeoutError struct{}
 
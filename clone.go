@@ -0,0 +1,133 @@
+package rawhttp
+
+import (
+	"maps"
+	"slices"
+)
+
+// Clone returns a deep copy of the request. The copy shares no memory with
+// the original except the template variable registries, which are safe for
+// concurrent use. Cloning only reads the original, so many goroutines may
+// clone the same template as long as none of them modifies it.
+func (obj *Request) Clone() *Request {
+	c := &Request{
+		Rawdata: cloneBytes(obj.Rawdata),
+		URL:     obj.URL,
+		IP:      obj.IP,
+
+		parsed:      obj.parsed,
+		httpLine:    cloneBytes(obj.httpLine),
+		method:      cloneBytes(obj.method),
+		path:        cloneBytes(obj.path),
+		version:     cloneBytes(obj.version),
+		rawHeaders:  cloneBytes(obj.rawHeaders),
+		body:        cloneBytes(obj.body),
+		rawBody:     obj.rawBody,
+		httpLineEOL: cloneBytes(obj.httpLineEOL),
+		headerEnd:   cloneBytes(obj.headerEnd),
+
+		variables:       obj.variables,
+		clientVariables: obj.clientVariables,
+		prepareErr:      obj.prepareErr,
+
+		cacheBusters: slices.Clone(obj.cacheBusters),
+	}
+	if obj.URI != nil {
+		uri := *obj.URI
+		c.URI = &uri
+	}
+	if obj.headers != nil {
+		c.headers = maps.Clone(obj.headers)
+		for k, hl := range c.headers {
+			hl.Key = cloneBytes(hl.Key)
+			hl.Value = cloneBytes(hl.Value)
+			hl.EOL = cloneBytes(hl.EOL)
+			hl.Raw = cloneBytes(hl.Raw)
+			c.headers[k] = hl
+		}
+	}
+	return c
+}
+
+// cloneBytes copies b, keeping nil as nil.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// derive returns a parsed clone of the request for the With* methods.
+func (obj *Request) derive() *Request {
+	c := obj.Clone()
+	c.ParseRawdata()
+	return c
+}
+
+// WithMethod returns a copy of the request with another method.
+func (obj *Request) WithMethod(method []byte) *Request {
+	c := obj.derive()
+	c.SetMethod(cloneBytes(method))
+	return c
+}
+
+// WithPath returns a copy of the request with another target.
+func (obj *Request) WithPath(path []byte) *Request {
+	c := obj.derive()
+	c.SetPath(cloneBytes(path))
+	return c
+}
+
+// WithVersion returns a copy of the request with another version.
+func (obj *Request) WithVersion(version []byte) *Request {
+	c := obj.derive()
+	c.SetVersion(cloneBytes(version))
+	return c
+}
+
+// WithRequestLine returns a copy of the request with a verbatim request
+// line, see SetRequestLine.
+func (obj *Request) WithRequestLine(line []byte) *Request {
+	c := obj.derive()
+	c.SetRequestLine(cloneBytes(line))
+	return c
+}
+
+// WithQueryParams returns a copy of the request with params appended to the
+// query, see AddQueryParams.
+func (obj *Request) WithQueryParams(params []byte) *Request {
+	c := obj.derive()
+	c.AddQueryParams(params)
+	return c
+}
+
+// WithHeader returns a copy of the request with a header set, see
+// SetHeader.
+func (obj *Request) WithHeader(key string, name, value []byte) *Request {
+	c := obj.derive()
+	c.SetHeader(key, cloneBytes(name), cloneBytes(value))
+	return c
+}
+
+// WithHeaderLine returns a copy of the request with a verbatim header line,
+// see SetHeaderLine.
+func (obj *Request) WithHeaderLine(key string, raw []byte) *Request {
+	c := obj.derive()
+	c.SetHeaderLine(key, cloneBytes(raw))
+	return c
+}
+
+// WithoutHeader returns a copy of the request without the header stored
+// under key.
+func (obj *Request) WithoutHeader(key string) *Request {
+	c := obj.derive()
+	c.DelHeader(key)
+	return c
+}
+
+// WithBody returns a copy of the request with another body.
+func (obj *Request) WithBody(body []byte) *Request {
+	c := obj.derive()
+	c.SetBody(cloneBytes(body))
+	return c
+}
@@ -0,0 +1,118 @@
+package rawhttp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newCloneTemplate(t *testing.T) *Request {
+	t.Helper()
+	req := &Request{
+		Rawdata: []byte("POST /a?x=1 HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\n\r\nbody"),
+		URL:     "https://example.com/a?x=1",
+	}
+	req.URI, _ = parseTestURL(req.URL)
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+	return req
+}
+
+func TestRequest_Clone(t *testing.T) {
+	orig := newCloneTemplate(t)
+	want := string(orig.Bytes())
+
+	c := orig.Clone()
+	if got := string(c.Bytes()); got != want {
+		t.Fatalf("clone Bytes() = %q, want %q", got, want)
+	}
+
+	// Write through every slice of the clone.
+	c.body[0] = 'B'
+	c.method[0] = 'X'
+	c.httpLine[0] = 'X'
+	hl := c.headers["x-a"]
+	hl.Value[0] = '9'
+	hl.Raw[0] = 'Y'
+	c.Rawdata[0] = 'Z'
+	c.URI.Path = "/changed"
+	c.SetHeader("x-b", []byte("X-B"), []byte("2"))
+	c.AddQueryParams([]byte("y=2"))
+
+	if got := string(orig.Bytes()); got != want {
+		t.Errorf("original Bytes() = %q, want %q", got, want)
+	}
+	if orig.URI.Path != "/a" {
+		t.Errorf("original URI.Path = %q", orig.URI.Path)
+	}
+	if _, ok := orig.headers["x-b"]; ok {
+		t.Error("header added to the original")
+	}
+}
+
+func TestRequest_With(t *testing.T) {
+	orig := newCloneTemplate(t)
+	want := string(orig.Bytes())
+
+	tests := []struct {
+		name string
+		req  *Request
+		want string
+	}{
+		{"method", orig.WithMethod([]byte("PUT")), "PUT /a?x=1 HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\n\r\nbody"},
+		{"path", orig.WithPath([]byte("/b")), "POST /b HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\n\r\nbody"},
+		{"version", orig.WithVersion([]byte("HTTP/1.0")), "POST /a?x=1 HTTP/1.0\r\nHost: example.com\r\nX-A: 1\r\n\r\nbody"},
+		{"request line", orig.WithRequestLine([]byte("GET  /")), "GET  /\r\nHost: example.com\r\nX-A: 1\r\n\r\nbody"},
+		{"query", orig.WithQueryParams([]byte("y=2")), "POST /a?x=1&y=2 HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\n\r\nbody"},
+		{"header", orig.WithHeader("x-a", []byte("X-A"), []byte("2")), "POST /a?x=1 HTTP/1.1\r\nHost: example.com\r\nX-A: 2\r\n\r\nbody"},
+		{"header line", orig.WithHeaderLine("x-b", []byte("X-B :3")), "POST /a?x=1 HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\nX-B :3\r\n\r\nbody"},
+		{"without header", orig.WithoutHeader("host"), "POST /a?x=1 HTTP/1.1\r\nX-A: 1\r\n\r\nbody"},
+		{"body", orig.WithBody([]byte("new")), "POST /a?x=1 HTTP/1.1\r\nHost: example.com\r\nX-A: 1\r\n\r\nnew"},
+		{"chained", orig.WithMethod([]byte("GET")).WithBody(nil).WithoutHeader("x-a"), "GET /a?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.req.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := string(orig.Bytes()); got != want {
+		t.Errorf("original Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestRequest_WithUnparsed(t *testing.T) {
+	orig := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n")}
+
+	got := string(orig.WithHeader("x", []byte("X"), []byte("1")).Bytes())
+	if want := "GET / HTTP/1.1\r\nHost: a\r\nX: 1\r\n\r\n"; got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+	if orig.parsed {
+		t.Error("original was parsed")
+	}
+}
+
+func TestRequest_CloneConcurrent(t *testing.T) {
+	orig := newCloneTemplate(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v := fmt.Sprint(i)
+			c := orig.WithHeader("x-a", []byte("X-A"), []byte(v)).WithQueryParams([]byte("i=" + v))
+			got := string(c.Bytes())
+			if !strings.Contains(got, "X-A: "+v+"\r\n") || !strings.Contains(got, "&i="+v+" ") {
+				t.Errorf("variant %d = %q", i, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/vodafon/rawhttp"
+)
+
+// runBatch implements "rawhttp batch": it streams rawhttp.BatchSpec lines
+// through rawhttp.RunBatch. With -resume, specs whose ID already has a
+// result in the output file are skipped and new results are appended;
+// specs that failed without a response are sent again.
+func runBatch(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rawhttp batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		input        = fs.String("i", "-", "JSONL file with request specs, - for stdin")
+		output       = fs.String("o", "-", "JSONL file for results, - for stdout")
+		resume       = fs.Bool("resume", false, "skip specs already answered in -o and append to it")
+		workers      = fs.Int("workers", rawhttp.DefaultBatchWorkers, "number of concurrent requests")
+		timeout      = fs.Duration("timeout", 10*time.Second, "dial and first byte timeout")
+		quietTimeout = fs.Duration("quiet-timeout", rawhttp.DefaultQuietTimeout, "silence after data that ends the response")
+		proxyURL     = fs.String("proxy", "", "proxy URL (http, https or socks5)")
+		keepAlive    = fs.Bool("keep-alive", true, "allow connection reuse")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *resume && *output == "-" {
+		fmt.Fprintln(stderr, "rawhttp batch: -resume requires -o")
+		return 2
+	}
+
+	var proxy *url.URL
+	if *proxyURL != "" {
+		u, err := url.Parse(*proxyURL)
+		if err != nil {
+			fmt.Fprintf(stderr, "rawhttp batch: invalid proxy URL: %v\n", err)
+			return 2
+		}
+		proxy = u
+	}
+
+	in := stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(stderr, "rawhttp batch: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	opts := rawhttp.BatchOptions{
+		Workers: *workers,
+		NewClient: func() *rawhttp.Client {
+			client := rawhttp.NewClientTransferVariables()
+			client.Timeout = *timeout
+			client.QuietTimeout = *quietTimeout
+			client.DisableKeepAlive = !*keepAlive
+			if proxy != nil {
+				client.SetProxy(proxy)
+			}
+			return client
+		},
+	}
+
+	out := stdout
+	if *output != "-" {
+		f, err := openBatchOutput(*output, *resume, &opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "rawhttp batch: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := rawhttp.RunBatch(ctx, in, out, opts); err != nil {
+		fmt.Fprintf(stderr, "rawhttp batch: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// openBatchOutput opens the result file. When resuming it loads the IDs
+// already written and makes sure appended results start on a new line.
+func openBatchOutput(name string, resume bool, opts *rawhttp.BatchOptions) (*os.File, error) {
+	if !resume {
+		return os.Create(name)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	opts.Completed, err = rawhttp.CompletedBatchIDs(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if end > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, end-1); err == nil && last[0] != '\n' {
+			f.Write([]byte("\n"))
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp"
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestRunBatch_Resume(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"),
+		rawhttptest.Close(),
+	})
+	defer srv.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "specs.jsonl")
+	output := filepath.Join(dir, "results.jsonl")
+
+	var specs bytes.Buffer
+	for _, id := range []string{"one", "two"} {
+		line, _ := json.Marshal(rawhttp.BatchSpec{
+			ID:  id,
+			URL: srv.URL + "/" + id,
+			Raw: "GET ||PATH|| HTTP/1.1\r\nHost: ||HOST||\r\n\r\n",
+		})
+		specs.Write(line)
+		specs.WriteString("\n")
+	}
+	os.WriteFile(input, specs.Bytes(), 0o644)
+
+	// A previous run finished "one" and was interrupted mid-line.
+	os.WriteFile(output, []byte(`{"id":"one","url":"x","status":200}`+"\n"+`{"id":"tw`), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"batch", "-i", input, "-o", output, "-resume", "-workers", "1"}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+
+	if n := len(srv.Conns()); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+
+	data, _ := os.ReadFile(output)
+	done, _ := rawhttp.CompletedBatchIDs(bytes.NewReader(data))
+	if !done["one"] || !done["two"] {
+		t.Errorf("results = %s", data)
+	}
+	if !strings.HasSuffix(string(data), "\n") {
+		t.Errorf("results file does not end with a newline: %q", data)
+	}
+}
+
+func TestRunBatch_ResumeRequiresOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"batch", "-resume"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("run() = %d, want 2", code)
+	}
+}
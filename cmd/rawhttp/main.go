@@ -0,0 +1,153 @@
+// Command rawhttp sends a raw HTTP request read from a file or stdin and
+// prints what came back.
+//
+// Usage:
+//
+//	rawhttp -u https://example.com/ [-ip 1.2.3.4] [-f request.txt] [flags]
+//	rawhttp batch [-i specs.jsonl] [-o results.jsonl] [-resume] [flags]
+//
+// The request may use the template variables understood by
+// rawhttp.PrepareRequestVariables (||HOST||, ||PATH||, ||CLEN||, ...).
+// The batch subcommand reads rawhttp.BatchSpec lines and writes
+// rawhttp.BatchResult lines.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/vodafon/rawhttp"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "batch" {
+		return runBatch(args[1:], stdin, stdout, stderr)
+	}
+	return runSend(args, stdin, stdout, stderr)
+}
+
+type sendResult struct {
+	URL             string  `json:"url"`
+	StatusCode      int     `json:"status"`
+	TimeToFirstByte float64 `json:"time_to_first_byte_ms"`
+	TimeToLastByte  float64 `json:"time_to_last_byte_ms"`
+	Raw             string  `json:"raw"`
+	Body            string  `json:"body"`
+	Error           string  `json:"error,omitempty"`
+}
+
+func runSend(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rawhttp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		target       = fs.String("u", "", "target URL (required)")
+		ip           = fs.String("ip", "", "dial this IP instead of resolving the URL host")
+		file         = fs.String("f", "-", "file with the raw request, - for stdin")
+		timeout      = fs.Duration("timeout", 10*time.Second, "dial and first byte timeout")
+		quietTimeout = fs.Duration("quiet-timeout", rawhttp.DefaultQuietTimeout, "silence after data that ends the response")
+		proxyURL     = fs.String("proxy", "", "proxy URL (http, https or socks5)")
+		keepAlive    = fs.Bool("keep-alive", true, "allow connection reuse")
+		format       = fs.String("o", "text", "output format: text or json")
+		keepEOL      = fs.Bool("keep-eol", false, "send line endings as written; by default a request without CRLF is converted to CRLF")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *target == "" {
+		fmt.Fprintln(stderr, "rawhttp: -u is required")
+		fs.Usage()
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "rawhttp: unknown output format %q\n", *format)
+		return 2
+	}
+
+	rawdata, err := readInput(*file, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "rawhttp: %v\n", err)
+		return 1
+	}
+	if !*keepEOL {
+		rawdata = rawhttp.NormalizeLineEndings(rawdata)
+	}
+
+	client := rawhttp.NewClientTransferVariables()
+	defer client.Close()
+	client.Timeout = *timeout
+	client.QuietTimeout = *quietTimeout
+	client.DisableKeepAlive = !*keepAlive
+	if *proxyURL != "" {
+		u, err := url.Parse(*proxyURL)
+		if err != nil {
+			fmt.Fprintf(stderr, "rawhttp: invalid proxy URL: %v\n", err)
+			return 2
+		}
+		client.SetProxy(u)
+	}
+
+	req := &rawhttp.Request{
+		Rawdata: rawdata,
+		URL:     *target,
+		IP:      *ip,
+	}
+	resp := client.NewResponse()
+	doErr := client.Do(req, resp)
+
+	res := sendResult{
+		URL:             *target,
+		TimeToFirstByte: milliseconds(resp.TimeToFirstByte),
+		TimeToLastByte:  milliseconds(resp.TimeToLastByte),
+		Raw:             string(resp.Rawdata),
+	}
+	if doErr != nil {
+		res.Error = doErr.Error()
+	} else {
+		res.StatusCode = resp.StatusCode()
+		res.Body = string(resp.Body())
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+	} else {
+		printText(stdout, res)
+	}
+
+	if doErr != nil {
+		if *format == "text" {
+			fmt.Fprintf(stderr, "rawhttp: %v\n", doErr)
+		}
+		return 1
+	}
+	return 0
+}
+
+func readInput(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" || name == "" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func printText(w io.Writer, res sendResult) {
+	fmt.Fprintf(w, "status: %d\n", res.StatusCode)
+	fmt.Fprintf(w, "time to first byte: %.3fms\n", res.TimeToFirstByte)
+	fmt.Fprintf(w, "time to last byte: %.3fms\n", res.TimeToLastByte)
+	fmt.Fprintf(w, "\n--- raw response ---\n%s\n", res.Raw)
+	fmt.Fprintf(w, "\n--- body ---\n%s\n", res.Body)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestRunSend_JSON(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"),
+	})
+	defer srv.Close()
+
+	stdin := strings.NewReader("POST ||PATH|| HTTP/1.1\nHost: ||HOST||\nContent-Length: ||CLEN||\n\nabc")
+	var stdout, stderr bytes.Buffer
+
+	code := run([]string{"-u", srv.URL + "/submit", "-o", "json"}, stdin, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+
+	var res sendResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout.String())
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", res.StatusCode)
+	}
+	if res.Body != "ok" {
+		t.Errorf("body = %q, want %q", res.Body, "ok")
+	}
+
+	want := "POST /submit HTTP/1.1\r\nHost: 127.0.0.1\r\nContent-Length: 3\r\n\r\nabc"
+	if got := string(srv.Conn(0).Received()); got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestRunSend_KeepEOL(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.Expect("\n\n"),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"),
+	})
+	defer srv.Close()
+
+	stdin := strings.NewReader("GET / HTTP/1.1\nHost: ||HOST||\n\n")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-u", srv.URL + "/", "-keep-eol"}, stdin, &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+
+	want := "GET / HTTP/1.1\nHost: 127.0.0.1\n\n"
+	if got := string(srv.Conn(0).Received()); got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestRunSend_TextFromFileWithIP(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 404 Not Found\r\nContent-Length: 4\r\n\r\nnope"),
+	})
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "req.txt")
+	os.WriteFile(path, []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), 0o644)
+
+	port := srv.Addr[strings.LastIndex(srv.Addr, ":")+1:]
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-u", "http://example.com:" + port + "/", "-ip", "127.0.0.1", "-f", path}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "status: 404") {
+		t.Errorf("output missing status:\n%s", out)
+	}
+	if !strings.Contains(out, "--- body ---\nnope") {
+		t.Errorf("output missing body:\n%s", out)
+	}
+	if got := string(srv.Conn(0).Received()); !strings.Contains(got, "Host: example.com\r\n") {
+		t.Errorf("server received %q, want Host: example.com", got)
+	}
+}
+
+func TestRunSend_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{
+			name:     "missing URL",
+			args:     []string{},
+			wantCode: 2,
+		},
+		{
+			name:     "unknown format",
+			args:     []string{"-u", "http://example.com/", "-o", "xml"},
+			wantCode: 2,
+		},
+		{
+			name:     "missing file",
+			args:     []string{"-u", "http://example.com/", "-f", "/nonexistent/req.txt"},
+			wantCode: 1,
+		},
+		{
+			name:     "invalid URL",
+			args:     []string{"-u", "/relative", "-f", "-"},
+			wantCode: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin := strings.NewReader("GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, stdin, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("run() = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+		})
+	}
+}
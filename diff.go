@@ -0,0 +1,464 @@
+package rawhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultIgnoreHeaders change between identical requests.
+var DefaultIgnoreHeaders = []string{
+	"Date",
+	"Age",
+	"Expires",
+	"Last-Modified",
+	"Etag",
+	"Set-Cookie",
+	"Content-Length",
+	"X-Request-Id",
+	"X-Amz-Cf-Id",
+	"Cf-Ray",
+	"X-Served-By",
+	"X-Timer",
+}
+
+// DefaultIgnorePatterns match dynamic tokens: HTTP and ISO 8601 dates,
+// Unix timestamps, UUIDs, long hex strings, and CSRF token and nonce
+// attribute values.
+var DefaultIgnorePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun), \d{2} (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{4} \d{2}:\d{2}:\d{2} GMT`),
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`),
+	regexp.MustCompile(`\b1\d{9}(?:\d{3})?\b`),
+	regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+	regexp.MustCompile(`(?i)\b[0-9a-f]{16,}\b`),
+	regexp.MustCompile(`(?i)((?:csrf|xsrf|token|authenticity_token|nonce)[^<>]{0,40}?(?:value|content|nonce)=["'])[^"']*`),
+	regexp.MustCompile(`(?i)(nonce=["'])[^"']*`),
+}
+
+const ignoredToken = "<ignored>"
+
+// DiffOptions configures DiffResponses. The zero value compares
+// everything; DefaultDiffOptions ignores the usual dynamic values.
+type DiffOptions struct {
+	// IgnoreHeaders are left out of the header comparison,
+	// case-insensitively.
+	IgnoreHeaders []string
+	// IgnorePatterns are replaced in header values and in the body before
+	// comparing. When a pattern has a capture group, the first group is
+	// kept and only the rest of the match is replaced.
+	IgnorePatterns []*regexp.Regexp
+	// TimingThreshold is the difference in time to first byte above which
+	// ResponseDiff.TimingChanged is set. Zero disables the check.
+	TimingThreshold time.Duration
+}
+
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{
+		IgnoreHeaders:  slices.Clone(DefaultIgnoreHeaders),
+		IgnorePatterns: slices.Clone(DefaultIgnorePatterns),
+	}
+}
+
+// DiffOp is the kind of a DiffLine.
+type DiffOp byte
+
+const (
+	DiffEqual  DiffOp = '='
+	DiffDelete DiffOp = '-'
+	DiffInsert DiffOp = '+'
+)
+
+// DiffLine is one line of a body diff. Line numbers are 1-based; the
+// number of the side the line does not exist in is 0.
+type DiffLine struct {
+	Op           DiffOp
+	BaselineLine int
+	ProbeLine    int
+	Text         string
+}
+
+// HeaderDiff is a header whose values differ. A nil side means the header
+// is missing there.
+type HeaderDiff struct {
+	Name     string
+	Baseline []string
+	Probe    []string
+}
+
+// ResponseDiff holds the differences between a baseline and a probe
+// response.
+type ResponseDiff struct {
+	BaselineStatus, ProbeStatus int
+	StatusChanged               bool
+
+	AddedHeaders       []string
+	RemovedHeaders     []string
+	ChangedHeaders     []HeaderDiff
+	HeaderOrderChanged bool
+
+	// BodyLines holds the inserted and deleted lines.
+	BodyLines   []DiffLine
+	LengthDelta int
+	WordDelta   int
+	// Similarity of the bodies from their simhashes, 1 for identical.
+	Similarity                    float64
+	BaselineSimHash, ProbeSimHash uint64
+
+	TimeToFirstByteDelta time.Duration
+	TimeToLastByteDelta  time.Duration
+	TimingChanged        bool
+}
+
+// Equal reports whether the responses do not differ in status, headers or
+// body. Timing is not considered.
+func (obj *ResponseDiff) Equal() bool {
+	return !obj.StatusChanged && len(obj.AddedHeaders) == 0 && len(obj.RemovedHeaders) == 0 &&
+		len(obj.ChangedHeaders) == 0 && !obj.HeaderOrderChanged && len(obj.BodyLines) == 0
+}
+
+// DiffResponses compares a probe response with a baseline. Bodies are
+// compared after content decoding. A body that cannot be decoded or
+// exceeds MaxDecodedBytes is compared as Body returns it, and the diff is
+// returned together with the *ContentEncodingError or *LimitError.
+func DiffResponses(baseline, probe *Response, opts DiffOptions) (*ResponseDiff, error) {
+	var errs []error
+	for _, r := range []struct {
+		name string
+		resp *Response
+	}{{"baseline", baseline}, {"probe", probe}} {
+		if err := r.resp.ParseRawdata(); err != nil {
+			if !r.resp.BodyError() {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, err))
+		}
+	}
+
+	d := &ResponseDiff{
+		BaselineStatus:       baseline.statusCode,
+		ProbeStatus:          probe.statusCode,
+		StatusChanged:        baseline.statusCode != probe.statusCode,
+		TimeToFirstByteDelta: probe.TimeToFirstByte - baseline.TimeToFirstByte,
+		TimeToLastByteDelta:  probe.TimeToLastByte - baseline.TimeToLastByte,
+	}
+	if opts.TimingThreshold > 0 {
+		delta := d.TimeToFirstByteDelta
+		d.TimingChanged = delta > opts.TimingThreshold || -delta > opts.TimingThreshold
+	}
+
+	d.diffHeaders(baseline, probe, opts)
+
+	a := opts.normalize(baseline.body)
+	b := opts.normalize(probe.body)
+	d.LengthDelta = len(probe.body) - len(baseline.body)
+	d.WordDelta = len(bytes.Fields(b)) - len(bytes.Fields(a))
+	d.BaselineSimHash = SimHash(a)
+	d.ProbeSimHash = SimHash(b)
+	d.Similarity = Similarity(d.BaselineSimHash, d.ProbeSimHash)
+	for _, l := range DiffLines(splitBodyLines(a), splitBodyLines(b)) {
+		if l.Op != DiffEqual {
+			d.BodyLines = append(d.BodyLines, l)
+		}
+	}
+	return d, errors.Join(errs...)
+}
+
+func (obj DiffOptions) ignored(name string) bool {
+	return slices.ContainsFunc(obj.IgnoreHeaders, func(v string) bool { return strings.EqualFold(v, name) })
+}
+
+func (obj DiffOptions) normalize(data []byte) []byte {
+	for _, re := range obj.IgnorePatterns {
+		repl := []byte(ignoredToken)
+		if re.NumSubexp() > 0 {
+			repl = []byte("${1}" + ignoredToken)
+		}
+		data = re.ReplaceAll(data, repl)
+	}
+	return data
+}
+
+func (obj *ResponseDiff) diffHeaders(baseline, probe *Response, opts DiffOptions) {
+	a, b := baseline.header, probe.header
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if opts.ignored(name) {
+			continue
+		}
+		av, aok := a[name]
+		bv, bok := b[name]
+		switch {
+		case !aok:
+			obj.AddedHeaders = append(obj.AddedHeaders, name)
+		case !bok:
+			obj.RemovedHeaders = append(obj.RemovedHeaders, name)
+		case !slices.Equal(opts.normalizeValues(av), opts.normalizeValues(bv)):
+			obj.ChangedHeaders = append(obj.ChangedHeaders, HeaderDiff{Name: name, Baseline: av, Probe: bv})
+		}
+	}
+
+	// compare the relative order of the headers present in both
+	keep := func(name string) bool {
+		_, aok := a[name]
+		_, bok := b[name]
+		return aok && bok && !opts.ignored(name)
+	}
+	ao := slices.DeleteFunc(headerOrder(baseline), func(n string) bool { return !keep(n) })
+	bo := slices.DeleteFunc(headerOrder(probe), func(n string) bool { return !keep(n) })
+	obj.HeaderOrderChanged = !slices.Equal(ao, bo)
+}
+
+func (obj DiffOptions) normalizeValues(vs []string) []string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = string(obj.normalize([]byte(v)))
+	}
+	return out
+}
+
+// headerOrder returns the canonical names of the response headers in the
+// order they were received.
+func headerOrder(resp *Response) []string {
+	var names []string
+	lines := bytes.Split(resp.preBody, []byte("\n"))
+	for _, line := range lines[1:] {
+		name, _, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		names = append(names, http.CanonicalHeaderKey(string(bytes.TrimSpace(name))))
+	}
+	return names
+}
+
+func splitBodyLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxDiffLines bounds the work of DiffLines. When more lines of both
+// inputs remain between the common prefix and suffix, they are reported as
+// one replaced block.
+const maxDiffLines = 4096
+
+// DiffLines returns the line diff of a and b with Myers' algorithm.
+func DiffLines(a, b []string) []DiffLine {
+	var out []DiffLine
+
+	// common prefix and suffix
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		out = append(out, DiffLine{Op: DiffEqual, BaselineLine: pre + 1, ProbeLine: pre + 1, Text: a[pre]})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	out = append(out, myers(a[pre:len(a)-suf], b[pre:len(b)-suf], pre, pre)...)
+
+	for i := 0; i < suf; i++ {
+		ai, bi := len(a)-suf+i, len(b)-suf+i
+		out = append(out, DiffLine{Op: DiffEqual, BaselineLine: ai + 1, ProbeLine: bi + 1, Text: a[ai]})
+	}
+	return out
+}
+
+// myers diffs a and b with the linear space refinement of Myers'
+// algorithm: the middle snake of a shortest edit script splits the inputs
+// into two smaller problems, so memory stays proportional to the input.
+func myers(a, b []string, aOff, bOff int) []DiffLine {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+	if len(a)+len(b) > maxDiffLines {
+		return replaceLines(a, b, aOff, bOff)
+	}
+	d := &myersDiff{a: a, b: b}
+	d.diff(0, len(a), 0, len(b))
+	for i := range d.out {
+		if d.out[i].BaselineLine != 0 {
+			d.out[i].BaselineLine += aOff
+		}
+		if d.out[i].ProbeLine != 0 {
+			d.out[i].ProbeLine += bOff
+		}
+	}
+	return d.out
+}
+
+type myersDiff struct {
+	a, b []string
+	// vf and vb are the furthest reaching x per diagonal of the forward
+	// and the backward search, reused across calls
+	vf, vb []int
+	out    []DiffLine
+}
+
+func (obj *myersDiff) equal(ai, bi int) {
+	obj.out = append(obj.out, DiffLine{Op: DiffEqual, BaselineLine: ai + 1, ProbeLine: bi + 1, Text: obj.a[ai]})
+}
+
+// diff appends the diff of a[aLo:aHi] and b[bLo:bHi].
+func (obj *myersDiff) diff(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && obj.a[aLo] == obj.b[bLo] {
+		obj.equal(aLo, bLo)
+		aLo++
+		bLo++
+	}
+	suf := 0
+	for aLo < aHi-suf && bLo < bHi-suf && obj.a[aHi-1-suf] == obj.b[bHi-1-suf] {
+		suf++
+	}
+	aHi, bHi = aHi-suf, bHi-suf
+
+	switch {
+	case aLo == aHi:
+		for ; bLo < bHi; bLo++ {
+			obj.out = append(obj.out, DiffLine{Op: DiffInsert, ProbeLine: bLo + 1, Text: obj.b[bLo]})
+		}
+	case bLo == bHi:
+		for ; aLo < aHi; aLo++ {
+			obj.out = append(obj.out, DiffLine{Op: DiffDelete, BaselineLine: aLo + 1, Text: obj.a[aLo]})
+		}
+	default:
+		x, y, u, v := obj.middleSnake(aLo, aHi, bLo, bHi)
+		obj.diff(aLo, x, bLo, y)
+		for ; x < u; x, y = x+1, y+1 {
+			obj.equal(x, y)
+		}
+		obj.diff(u, aHi, v, bHi)
+	}
+
+	for i := 0; i < suf; i++ {
+		obj.equal(aHi+i, bHi+i)
+	}
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the middle snake
+// of a shortest edit script of a[aLo:aHi] and b[bLo:bHi]. Both ranges are
+// non-empty and differ in their first and last lines.
+func (obj *myersDiff) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	dmax := (n + m + 1) / 2
+	off := dmax + 1
+	if size := 2*off + 1; len(obj.vf) < size {
+		obj.vf = make([]int, size)
+		obj.vb = make([]int, size)
+	}
+	vf, vb := obj.vf, obj.vb
+	vf[off+1], vb[off+1] = 0, 0
+
+	for d := 0; d <= dmax; d++ {
+		// forward search from the start, on diagonal k = x - y
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && vf[off+k-1] < vf[off+k+1] {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			x0 := x
+			for x < n && x-k < m && obj.a[aLo+x] == obj.b[bLo+x-k] {
+				x++
+			}
+			vf[off+k] = x
+			// the backward search of step d-1 reaches diagonal delta-k
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+vb[off+c] >= n {
+				return aLo + x0, bLo + x0 - k, aLo + x, bLo + x - k
+			}
+		}
+		// backward search from the end, on reversed diagonal c
+		for c := -d; c <= d; c += 2 {
+			var x int
+			if c == -d || c != d && vb[off+c-1] < vb[off+c+1] {
+				x = vb[off+c+1]
+			} else {
+				x = vb[off+c-1] + 1
+			}
+			x0 := x
+			for x < n && x-c < m && obj.a[aHi-1-x] == obj.b[bHi-1-x+c] {
+				x++
+			}
+			vb[off+c] = x
+			if k := delta - c; !odd && k >= -d && k <= d && x+vf[off+k] >= n {
+				return aHi - x, bHi - x + c, aHi - x0, bHi - x0 + c
+			}
+		}
+	}
+	// not reached: a shortest edit script has at most n+m edits
+	return aLo, bLo, aLo, bLo
+}
+
+func replaceLines(a, b []string, aOff, bOff int) []DiffLine {
+	out := make([]DiffLine, 0, len(a)+len(b))
+	for i, l := range a {
+		out = append(out, DiffLine{Op: DiffDelete, BaselineLine: aOff + i + 1, Text: l})
+	}
+	for i, l := range b {
+		out = append(out, DiffLine{Op: DiffInsert, ProbeLine: bOff + i + 1, Text: l})
+	}
+	return out
+}
+
+// SimHash returns a 64-bit similarity hash of the words in data. Similar
+// texts have hashes with a small Hamming distance.
+func SimHash(data []byte) uint64 {
+	var weights [64]int
+	words := bytes.FieldsFunc(data, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if len(words) == 0 {
+		return 0
+	}
+	for _, w := range words {
+		h := fnv.New64a()
+		h.Write(bytes.ToLower(w))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	var hash uint64
+	for i, w := range weights {
+		if w > 0 {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// Similarity returns 1 minus the normalized Hamming distance of two
+// simhashes.
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
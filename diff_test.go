@@ -0,0 +1,280 @@
+package rawhttp
+
+import (
+	"errors"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", "=a =b"},
+		{"insert", "a\nc\n", "a\nb\nc\n", "=a +b =c"},
+		{"delete", "a\nb\nc\n", "a\nc\n", "=a -b =c"},
+		{"replace", "a\nb\nc\n", "a\nx\nc\n", "=a -b +x =c"},
+		{"empty baseline", "", "a\n", "+a"},
+		{"empty probe", "a\n", "", "-a"},
+		{"interleaved", "a\nb\nc\nd\n", "b\nc\ne\nd\n", "-a =b =c +e =d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, l := range DiffLines(splitBodyLines([]byte(tt.a)), splitBodyLines([]byte(tt.b))) {
+				got = append(got, string(l.Op)+strings.TrimSuffix(l.Text, "\n"))
+			}
+			if s := strings.Join(got, " "); s != tt.want {
+				t.Errorf("DiffLines() = %q, want %q", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines_LineNumbers(t *testing.T) {
+	lines := DiffLines([]string{"a", "b", "c"}, []string{"a", "x", "c"})
+	want := []DiffLine{
+		{Op: DiffEqual, BaselineLine: 1, ProbeLine: 1, Text: "a"},
+		{Op: DiffDelete, BaselineLine: 2, Text: "b"},
+		{Op: DiffInsert, ProbeLine: 2, Text: "x"},
+		{Op: DiffEqual, BaselineLine: 3, ProbeLine: 3, Text: "c"},
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("DiffLines() = %+v, want %+v", lines, want)
+	}
+}
+
+func TestDiffLines_Minimal(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	gen := func() []string {
+		lines := make([]string, r.IntN(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.IntN(3)))
+		}
+		return lines
+	}
+	for range 2000 {
+		a, b := gen(), gen()
+		var gotA, gotB []string
+		edits := 0
+		for _, l := range DiffLines(a, b) {
+			if l.Op != DiffInsert {
+				gotA = append(gotA, a[l.BaselineLine-1])
+			}
+			if l.Op != DiffDelete {
+				gotB = append(gotB, b[l.ProbeLine-1])
+			}
+			if l.Op != DiffEqual {
+				edits++
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("DiffLines(%q, %q) does not rebuild the inputs", a, b)
+		}
+
+		// edit distance from the longest common subsequence
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if want := len(a) + len(b) - 2*lcs[0][0]; edits != want {
+			t.Fatalf("DiffLines(%q, %q) has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func TestDiffLines_DisjointMemory(t *testing.T) {
+	a := make([]string, 2040)
+	b := make([]string, 2040)
+	for i := range a {
+		a[i] = "a" + strconv.Itoa(i) + "\n"
+		b[i] = "b" + strconv.Itoa(i) + "\n"
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	lines := DiffLines(a, b)
+	runtime.ReadMemStats(&after)
+
+	if len(lines) != len(a)+len(b) {
+		t.Errorf("len(DiffLines()) = %d, want %d", len(lines), len(a)+len(b))
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 8<<20 {
+		t.Errorf("DiffLines() allocated %d bytes", alloc)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	a := SimHash([]byte("the quick brown fox jumps over the lazy dog near the river bank today"))
+	b := SimHash([]byte("the quick brown fox jumps over the lazy cat near the river bank today"))
+	c := SimHash([]byte("404 page not found"))
+
+	if got := Similarity(a, a); got != 1 {
+		t.Errorf("Similarity(a, a) = %v, want 1", got)
+	}
+	if Similarity(a, b) <= Similarity(a, c) {
+		t.Errorf("similar texts scored %v, unrelated %v", Similarity(a, b), Similarity(a, c))
+	}
+	if got := SimHash(nil); got != 0 {
+		t.Errorf("SimHash(nil) = %x, want 0", got)
+	}
+}
+
+func TestDiffResponses(t *testing.T) {
+	baseline := "HTTP/1.1 200 OK\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 GMT\r\n" +
+		"Content-Type: text/html\r\n" +
+		"X-Frame-Options: DENY\r\n" +
+		"Server: nginx\r\n" +
+		"\r\n" +
+		"<html>\n<input name=\"csrf_token\" value=\"abc123\">\n<p>Hello</p>\n</html>\n"
+
+	tests := []struct {
+		name  string
+		probe string
+		opts  DiffOptions
+		check func(t *testing.T, d *ResponseDiff)
+	}{
+		{
+			name: "only dynamic values differ",
+			probe: "HTTP/1.1 200 OK\r\n" +
+				"Date: Tue, 03 Jan 2006 10:00:00 GMT\r\n" +
+				"Content-Type: text/html\r\n" +
+				"X-Frame-Options: DENY\r\n" +
+				"Server: nginx\r\n" +
+				"\r\n" +
+				"<html>\n<input name=\"csrf_token\" value=\"zzz999\">\n<p>Hello</p>\n</html>\n",
+			opts: DefaultDiffOptions(),
+			check: func(t *testing.T, d *ResponseDiff) {
+				if !d.Equal() {
+					t.Errorf("Equal() = false, diff %+v", d)
+				}
+				if d.Similarity != 1 {
+					t.Errorf("Similarity = %v, want 1", d.Similarity)
+				}
+			},
+		},
+		{
+			name: "dynamic values without ignore rules",
+			probe: "HTTP/1.1 200 OK\r\n" +
+				"Date: Tue, 03 Jan 2006 10:00:00 GMT\r\n" +
+				"Content-Type: text/html\r\n" +
+				"X-Frame-Options: DENY\r\n" +
+				"Server: nginx\r\n" +
+				"\r\n" +
+				"<html>\n<input name=\"csrf_token\" value=\"zzz999\">\n<p>Hello</p>\n</html>\n",
+			check: func(t *testing.T, d *ResponseDiff) {
+				if len(d.ChangedHeaders) != 1 || d.ChangedHeaders[0].Name != "Date" {
+					t.Errorf("ChangedHeaders = %+v, want Date", d.ChangedHeaders)
+				}
+				if len(d.BodyLines) != 2 || d.BodyLines[0].Op != DiffDelete || d.BodyLines[1].Op != DiffInsert {
+					t.Errorf("BodyLines = %+v, want one replaced line", d.BodyLines)
+				}
+			},
+		},
+		{
+			name: "status, headers and body",
+			probe: "HTTP/1.1 302 Found\r\n" +
+				"Date: Tue, 03 Jan 2006 10:00:00 GMT\r\n" +
+				"Server: nginx\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"Location: /login\r\n" +
+				"\r\n" +
+				"<html>\n<input name=\"csrf_token\" value=\"abc123\">\n<p>Redirecting to login</p>\n</html>\n",
+			opts: DefaultDiffOptions(),
+			check: func(t *testing.T, d *ResponseDiff) {
+				if !d.StatusChanged || d.BaselineStatus != 200 || d.ProbeStatus != 302 {
+					t.Errorf("status = %d -> %d, changed %t", d.BaselineStatus, d.ProbeStatus, d.StatusChanged)
+				}
+				if !slices.Equal(d.AddedHeaders, []string{"Location"}) {
+					t.Errorf("AddedHeaders = %v", d.AddedHeaders)
+				}
+				if !slices.Equal(d.RemovedHeaders, []string{"X-Frame-Options"}) {
+					t.Errorf("RemovedHeaders = %v", d.RemovedHeaders)
+				}
+				if len(d.ChangedHeaders) != 1 || d.ChangedHeaders[0].Name != "Content-Type" ||
+					d.ChangedHeaders[0].Baseline[0] != "text/html" || d.ChangedHeaders[0].Probe[0] != "text/plain" {
+					t.Errorf("ChangedHeaders = %+v", d.ChangedHeaders)
+				}
+				if !d.HeaderOrderChanged {
+					t.Error("HeaderOrderChanged = false")
+				}
+				if d.LengthDelta != len("Redirecting to login")-len("Hello") {
+					t.Errorf("LengthDelta = %d", d.LengthDelta)
+				}
+				if d.WordDelta != 2 {
+					t.Errorf("WordDelta = %d, want 2", d.WordDelta)
+				}
+				if d.Similarity >= 1 {
+					t.Errorf("Similarity = %v, want < 1", d.Similarity)
+				}
+				if d.Equal() {
+					t.Error("Equal() = true")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := DiffResponses(&Response{Rawdata: []byte(baseline)}, &Response{Rawdata: []byte(tt.probe)}, tt.opts)
+			if err != nil {
+				t.Fatalf("DiffResponses() error = %v", err)
+			}
+			tt.check(t, d)
+		})
+	}
+}
+
+func TestDiffResponses_Timing(t *testing.T) {
+	raw := []byte("HTTP/1.1 200 OK\r\n\r\nok")
+	baseline := &Response{Rawdata: raw, TimeToFirstByte: 100 * time.Millisecond}
+	probe := &Response{Rawdata: raw, TimeToFirstByte: 3 * time.Second}
+
+	d, err := DiffResponses(baseline, probe, DiffOptions{TimingThreshold: time.Second})
+	if err != nil {
+		t.Fatalf("DiffResponses() error = %v", err)
+	}
+	if d.TimeToFirstByteDelta != 2900*time.Millisecond || !d.TimingChanged {
+		t.Errorf("TimeToFirstByteDelta = %v, TimingChanged = %t", d.TimeToFirstByteDelta, d.TimingChanged)
+	}
+	if !d.Equal() {
+		t.Error("Equal() = false, timing must not count")
+	}
+}
+
+func TestDiffResponses_InvalidResponse(t *testing.T) {
+	ok := &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\n\r\n")}
+	bad := &Response{Rawdata: []byte("HTTP/1.1 abc\r\n\r\n")}
+	if _, err := DiffResponses(ok, bad, DiffOptions{}); err == nil {
+		t.Error("DiffResponses() error = nil, want error")
+	}
+}
+
+func TestDiffResponses_BodyError(t *testing.T) {
+	baseline := &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")}
+	probe := &Response{Rawdata: []byte("HTTP/1.1 500 Error\r\nContent-Encoding: gzip\r\nContent-Length: 7\r\n\r\nnotgzip")}
+	d, err := DiffResponses(baseline, probe, DiffOptions{})
+	var encErr *ContentEncodingError
+	if !errors.As(err, &encErr) {
+		t.Fatalf("DiffResponses() error = %v, want *ContentEncodingError", err)
+	}
+	if d == nil || !d.StatusChanged || d.ProbeStatus != 500 || d.LengthDelta != 5 {
+		t.Errorf("diff = %+v, want the parsed responses compared", d)
+	}
+}
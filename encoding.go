@@ -0,0 +1,150 @@
+package rawhttp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentEncodingError reports a body that could not be decoded.
+type ContentEncodingError struct {
+	Encoding string
+	Err      error
+}
+
+func (obj *ContentEncodingError) Error() string {
+	return fmt.Sprintf("content-encoding %q: %v", obj.Encoding, obj.Err)
+}
+
+func (obj *ContentEncodingError) Unwrap() error {
+	return obj.Err
+}
+
+// contentEncodings returns the content codings of the header, lowercased,
+// in the order they were applied. Several header lines are joined.
+func contentEncodings(h http.Header) []string {
+	var codings []string
+	for _, v := range h.Values("Content-Encoding") {
+		for _, c := range strings.Split(v, ",") {
+			c = strings.ToLower(strings.TrimSpace(c))
+			if c != "" && c != "identity" {
+				codings = append(codings, c)
+			}
+		}
+	}
+	return codings
+}
+
+// decodeBody undoes the content codings in reverse order of application:
+// "gzip, br" is decoded with brotli, then gzip. Decoding stops at the first
+// unknown coding, leaving the body encoded from there. Close releases the
+// decoders, not r.
+func decodeBody(r io.Reader, codings []string) (io.ReadCloser, error) {
+	chain := &decoderChain{r: r}
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		var closer io.Closer
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			var zr *gzip.Reader
+			zr, err = gzip.NewReader(chain.r)
+			if err == io.EOF {
+				// an empty body, e.g. the reply to HEAD
+				chain.r = bytes.NewReader(nil)
+				continue
+			}
+			chain.r, closer = zr, zr
+		case "br":
+			chain.r = brotli.NewReader(chain.r)
+		case "deflate":
+			chain.r, closer, err = newDeflateReader(chain.r)
+		case "zstd":
+			var zr *zstd.Decoder
+			zr, err = zstd.NewReader(chain.r, zstd.WithDecoderConcurrency(1))
+			if err == nil {
+				chain.r, closer = zr, zstdCloser{zr}
+			}
+		default:
+			return chain, nil
+		}
+		if err != nil {
+			chain.Close()
+			return nil, &ContentEncodingError{Encoding: codings[i], Err: err}
+		}
+		chain.r = &codingReader{r: chain.r, coding: codings[i]}
+		if closer != nil {
+			chain.closers = append(chain.closers, closer)
+		}
+	}
+	return chain, nil
+}
+
+// newDeflateReader reads "deflate" bodies, which should be zlib streams but
+// are raw DEFLATE data from many servers.
+func newDeflateReader(r io.Reader) (io.Reader, io.Closer, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(2)
+	if len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	}
+	fr := flate.NewReader(br)
+	return fr, fr, nil
+}
+
+type decoderChain struct {
+	r       io.Reader
+	closers []io.Closer
+}
+
+func (obj *decoderChain) Read(p []byte) (int, error) {
+	return obj.r.Read(p)
+}
+
+func (obj *decoderChain) Close() error {
+	for i := len(obj.closers) - 1; i >= 0; i-- {
+		obj.closers[i].Close()
+	}
+	obj.closers = nil
+	return nil
+}
+
+// codingReader wraps the read errors of one decoder in a
+// ContentEncodingError.
+type codingReader struct {
+	r      io.Reader
+	coding string
+}
+
+func (obj *codingReader) Read(p []byte) (int, error) {
+	n, err := obj.r.Read(p)
+	if err != nil && err != io.EOF {
+		var cerr *ContentEncodingError
+		if !errors.As(err, &cerr) {
+			err = &ContentEncodingError{Encoding: obj.coding, Err: err}
+		}
+	}
+	return n, err
+}
+
+type zstdCloser struct {
+	d *zstd.Decoder
+}
+
+func (obj zstdCloser) Close() error {
+	obj.d.Close()
+	return nil
+}
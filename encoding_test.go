@@ -0,0 +1,137 @@
+package rawhttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encodeWith(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "zstd":
+		zw, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zw.Close()
+		return zw.EncodeAll(data, nil)
+	default:
+		t.Fatalf("unknown coding %q", coding)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func rawResponse(headers string, body []byte) []byte {
+	return append([]byte("HTTP/1.1 200 OK\r\n"+headers+"Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"), body...)
+}
+
+func TestResponse_ContentEncoding(t *testing.T) {
+	plain := []byte("hello encoded world")
+	tests := []struct {
+		name    string
+		headers string
+		body    []byte
+		want    []byte
+	}{
+		{"gzip", "Content-Encoding: gzip\r\n", encodeWith(t, "gzip", plain), plain},
+		{"x-gzip", "Content-Encoding: x-gzip\r\n", encodeWith(t, "gzip", plain), plain},
+		{"uppercase", "Content-Encoding: GZIP\r\n", encodeWith(t, "gzip", plain), plain},
+		{"br", "Content-Encoding: br\r\n", encodeWith(t, "br", plain), plain},
+		{"deflate zlib", "Content-Encoding: deflate\r\n", encodeWith(t, "zlib", plain), plain},
+		{"deflate raw", "Content-Encoding: deflate\r\n", encodeWith(t, "flate", plain), plain},
+		{"zstd", "Content-Encoding: zstd\r\n", encodeWith(t, "zstd", plain), plain},
+		{"identity", "Content-Encoding: identity\r\n", plain, plain},
+		{
+			name:    "stacked",
+			headers: "Content-Encoding: gzip, br\r\n",
+			body:    encodeWith(t, "br", encodeWith(t, "gzip", plain)),
+			want:    plain,
+		},
+		{
+			name:    "stacked over header lines",
+			headers: "Content-Encoding: zstd\r\nContent-Encoding: Gzip\r\n",
+			body:    encodeWith(t, "gzip", encodeWith(t, "zstd", plain)),
+			want:    plain,
+		},
+		{
+			name:    "unknown coding stops decoding",
+			headers: "Content-Encoding: gzip, custom\r\n",
+			body:    []byte("opaque"),
+			want:    []byte("opaque"),
+		},
+		{
+			name:    "empty gzip body",
+			headers: "Content-Encoding: gzip\r\n",
+			body:    nil,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Rawdata: rawResponse(tt.headers, tt.body)}
+			if err := resp.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error = %v", err)
+			}
+			if !bytes.Equal(resp.Body(), tt.want) {
+				t.Errorf("Body() = %q, want %q", resp.Body(), tt.want)
+			}
+			if !bytes.Equal(resp.RawBody(), tt.body) {
+				t.Errorf("RawBody() = %q, want %q", resp.RawBody(), tt.body)
+			}
+		})
+	}
+}
+
+func TestResponse_ContentEncodingErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  string
+		body     []byte
+		encoding string
+	}{
+		{"bad gzip header", "Content-Encoding: gzip\r\n", []byte("not gzip at all"), "gzip"},
+		{"truncated gzip", "Content-Encoding: gzip\r\n", encodeWith(t, "gzip", []byte("hello"))[:15], "gzip"},
+		{"bad zstd", "Content-Encoding: zstd\r\n", []byte("not zstd"), "zstd"},
+		{"bad inner coding", "Content-Encoding: gzip, br\r\n", encodeWith(t, "br", []byte("not gzip")), "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Rawdata: rawResponse(tt.headers, tt.body)}
+			err := resp.ParseRawdata()
+			var cerr *ContentEncodingError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("ParseRawdata() error = %v, want ContentEncodingError", err)
+			}
+			if cerr.Encoding != tt.encoding {
+				t.Errorf("Encoding = %q, want %q", cerr.Encoding, tt.encoding)
+			}
+			if resp.StatusCode() != 200 {
+				t.Errorf("StatusCode() = %d, want 200", resp.StatusCode())
+			}
+			if !bytes.Equal(resp.Body(), tt.body) {
+				t.Errorf("Body() = %q, want the encoded body", resp.Body())
+			}
+		})
+	}
+}
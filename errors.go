@@ -0,0 +1,225 @@
+package rawhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Phase is the step of an exchange in which a NetError occurred.
+type Phase int
+
+const (
+	// PhaseDial: connecting to the target or the proxy.
+	PhaseDial Phase = iota
+	// PhaseProxy: asking the proxy for a tunnel.
+	PhaseProxy
+	// PhaseTLS: the TLS handshake with the target.
+	PhaseTLS
+	// PhaseWrite: sending the request.
+	PhaseWrite
+	// PhaseRead: reading the response.
+	PhaseRead
+)
+
+func (obj Phase) String() string {
+	switch obj {
+	case PhaseDial:
+		return "dial"
+	case PhaseProxy:
+		return "proxy"
+	case PhaseTLS:
+		return "tls"
+	case PhaseWrite:
+		return "write"
+	case PhaseRead:
+		return "read"
+	}
+	return fmt.Sprintf("Phase(%d)", int(obj))
+}
+
+// NetErrorKind classifies a NetError. The kinds are errors themselves, so
+// errors.Is(err, NetConnectRefused) tells whether err is a NetError of
+// that kind.
+type NetErrorKind int
+
+const (
+	// NetDNS: the host name could not be resolved.
+	NetDNS NetErrorKind = iota
+	// NetConnectRefused: nothing listens on the address.
+	NetConnectRefused
+	// NetConnectTimeout: the connection was not established within
+	// Client.Timeout.
+	NetConnectTimeout
+	// NetConnect: any other failure to connect, directly or through the
+	// proxy.
+	NetConnect
+	// NetTLSHandshake: the TLS handshake failed.
+	NetTLSHandshake
+	// NetProxyRejected: the proxy refused the tunnel, see
+	// NetError.StatusCode.
+	NetProxyRejected
+	// NetWrite: the request could not be sent.
+	NetWrite
+	// NetReadTimeout: no response byte arrived within Client.Timeout.
+	NetReadTimeout
+	// NetRead: the response could not be read, e.g. the connection was
+	// closed before the first byte.
+	NetRead
+	// NetStaleConn: a pooled connection was closed by the server and the
+	// request could not be replayed on a new one.
+	NetStaleConn
+)
+
+func (obj NetErrorKind) String() string {
+	switch obj {
+	case NetDNS:
+		return "dns lookup failed"
+	case NetConnectRefused:
+		return "connection refused"
+	case NetConnectTimeout:
+		return "connect timeout"
+	case NetConnect:
+		return "connect failed"
+	case NetTLSHandshake:
+		return "tls handshake failed"
+	case NetProxyRejected:
+		return "proxy rejected tunnel"
+	case NetWrite:
+		return "write failed"
+	case NetReadTimeout:
+		return "read timeout"
+	case NetRead:
+		return "read failed"
+	case NetStaleConn:
+		return "stale connection"
+	}
+	return fmt.Sprintf("NetErrorKind(%d)", int(obj))
+}
+
+func (obj NetErrorKind) Error() string {
+	return obj.String()
+}
+
+// NetError is a network failure of Client.Do and Client.DoStream. The
+// underlying error stays available to errors.Is and errors.As.
+type NetError struct {
+	Kind  NetErrorKind
+	Phase Phase
+	// Addr is the address being talked to: the proxy during PhaseProxy and
+	// when dialing it, the target otherwise.
+	Addr string
+	// StatusCode is the status of the proxy response for NetProxyRejected,
+	// zero when there was none.
+	StatusCode int
+	Err        error
+}
+
+func (obj *NetError) Error() string {
+	msg := fmt.Sprintf("%s (%s %s)", obj.Kind, obj.Phase, obj.Addr)
+	if obj.StatusCode != 0 {
+		msg += fmt.Sprintf(": status %d", obj.StatusCode)
+	}
+	if obj.Err != nil {
+		msg += ": " + obj.Err.Error()
+	}
+	return msg
+}
+
+func (obj *NetError) Unwrap() error {
+	return obj.Err
+}
+
+// Is reports whether target is the kind of obj.
+func (obj *NetError) Is(target error) bool {
+	kind, ok := target.(NetErrorKind)
+	return ok && kind == obj.Kind
+}
+
+// Timeout implements net.Error.
+func (obj *NetError) Timeout() bool {
+	return obj.Kind == NetConnectTimeout || obj.Kind == NetReadTimeout || isTimeoutError(obj.Err)
+}
+
+// Temporary implements net.Error.
+func (obj *NetError) Temporary() bool {
+	return obj.Timeout()
+}
+
+// netError classifies err as a NetError of phase. Errors that already are
+// a NetError are returned unchanged.
+func netError(phase Phase, addr string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var nerr *NetError
+	if errors.As(err, &nerr) {
+		return err
+	}
+
+	var dnsErr *net.DNSError
+	kind := NetRead
+	switch {
+	case errors.As(err, &dnsErr):
+		kind = NetDNS
+	case phase == PhaseDial && errors.Is(err, syscall.ECONNREFUSED):
+		kind = NetConnectRefused
+	case phase == PhaseDial && isTimeoutError(err):
+		kind = NetConnectTimeout
+	case phase == PhaseTLS || isTLSError(err):
+		kind = NetTLSHandshake
+	case phase == PhaseDial || phase == PhaseProxy:
+		kind = NetConnect
+	case phase == PhaseWrite:
+		kind = NetWrite
+	case isTimeoutError(err):
+		kind = NetReadTimeout
+	}
+	return &NetError{Kind: kind, Phase: phase, Addr: addr, Err: err}
+}
+
+// isTLSError reports whether err comes from the TLS stack.
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &verifyErr) || errors.As(err, &unknownAuthErr)
+}
+
+// isStaleConnError returns true if the error indicates a stale/closed connection
+// that may have been valid when pooled but is no longer usable.
+// This helps detect connections closed by the server due to keep-alive timeout.
+func isStaleConnError(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// staleConnError returns err from a pooled connection as a NetStaleConn
+// error when the write or read failed because the server had closed the
+// idle connection. Other errors, and nil, are returned unchanged.
+func staleConnError(err error) error {
+	var nerr *NetError
+	if !errors.As(err, &nerr) || nerr.Phase != PhaseWrite && nerr.Phase != PhaseRead || !isStaleConnError(nerr.Err) {
+		return err
+	}
+	stale := *nerr
+	stale.Kind = NetStaleConn
+	return &stale
+}
+
+// redialError reports the failed dial replacing a stale pooled connection.
+// The request was not replayed, so the NetStaleConn error stays first.
+func redialError(stale, err error) error {
+	if stale == nil {
+		return err
+	}
+	return fmt.Errorf("%w; redial: %w", stale, err)
+}
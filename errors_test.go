@@ -0,0 +1,233 @@
+package rawhttp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestNetError(t *testing.T) {
+	err := error(&NetError{
+		Kind:  NetConnectRefused,
+		Phase: PhaseDial,
+		Addr:  "127.0.0.1:1",
+		Err:   &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+	})
+
+	if !errors.Is(err, NetConnectRefused) || errors.Is(err, NetConnectTimeout) {
+		t.Errorf("errors.Is kind mismatch for %v", err)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Error("underlying error is not reachable")
+	}
+	want := "connection refused (dial 127.0.0.1:1): dial tcp: connection refused"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	rejected := &NetError{Kind: NetProxyRejected, Phase: PhaseProxy, Addr: "proxy:8080", StatusCode: 407}
+	if want := "proxy rejected tunnel (proxy proxy:8080): status 407"; rejected.Error() != want {
+		t.Errorf("Error() = %q, want %q", rejected.Error(), want)
+	}
+}
+
+func TestNetErrorClassification(t *testing.T) {
+	tests := []struct {
+		name        string
+		phase       Phase
+		err         error
+		want        NetErrorKind
+		wantTimeout bool
+	}{
+		{"dns", PhaseDial, &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "x.invalid"}}, NetDNS, false},
+		{"refused", PhaseDial, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, NetConnectRefused, false},
+		{"connect timeout", PhaseDial, &timeoutError{}, NetConnectTimeout, true},
+		{"unreachable", PhaseDial, &net.OpError{Op: "dial", Err: syscall.EHOSTUNREACH}, NetConnect, false},
+		{"tls", PhaseTLS, errors.New("tls: handshake failure"), NetTLSHandshake, false},
+		{"tls timeout", PhaseTLS, &timeoutError{}, NetTLSHandshake, true},
+		{"proxy", PhaseProxy, io.ErrUnexpectedEOF, NetConnect, false},
+		{"write", PhaseWrite, syscall.EPIPE, NetWrite, false},
+		{"read timeout", PhaseRead, &timeoutError{}, NetReadTimeout, true},
+		{"read eof", PhaseRead, io.EOF, NetRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := netError(tt.phase, "host:80", tt.err)
+			var nerr *NetError
+			if !errors.As(err, &nerr) {
+				t.Fatalf("netError() = %v, want *NetError", err)
+			}
+			if nerr.Kind != tt.want || nerr.Phase != tt.phase || nerr.Addr != "host:80" {
+				t.Errorf("netError() = %s/%s/%s, want %s/%s/host:80", nerr.Kind, nerr.Phase, nerr.Addr, tt.want, tt.phase)
+			}
+			if nerr.Timeout() != tt.wantTimeout {
+				t.Errorf("Timeout() = %t, want %t", nerr.Timeout(), tt.wantTimeout)
+			}
+			if netError(PhaseRead, "other:80", err) != err {
+				t.Error("a NetError is classified again")
+			}
+		})
+	}
+}
+
+func TestClient_Do_NetErrors(t *testing.T) {
+	// a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := l.Addr().String()
+	l.Close()
+
+	plain := rawhttptest.NewServer(rawhttptest.Script{rawhttptest.Read(1)})
+	defer plain.Close()
+	silent := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Sleep(time.Second),
+	})
+	defer silent.Close()
+	closing := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Close(),
+	})
+	defer closing.Close()
+	proxySrv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n"),
+	})
+	defer proxySrv.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		proxy      string
+		wantKind   NetErrorKind
+		wantPhase  Phase
+		wantAddr   string
+		wantStatus int
+	}{
+		{"refused", "http://" + closedAddr + "/", "", NetConnectRefused, PhaseDial, closedAddr, 0},
+		{"tls on plain server", "https://" + plain.URL[len("http://"):] + "/", "", NetTLSHandshake, PhaseTLS, plain.URL[len("http://"):], 0},
+		{"read timeout", silent.URL + "/", "", NetReadTimeout, PhaseRead, silent.URL[len("http://"):], 0},
+		{"closed before response", closing.URL + "/", "", NetRead, PhaseRead, closing.URL[len("http://"):], 0},
+		{"proxy rejected", "http://example.com/", proxySrv.URL, NetProxyRejected, PhaseProxy, proxySrv.URL[len("http://"):], 407},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewDefaultClientTimeout(200 * time.Millisecond)
+			defer client.Close()
+			if tt.proxy != "" {
+				u, _ := url.Parse(tt.proxy)
+				client.SetProxy(u)
+			}
+
+			req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: tt.url}
+			err := client.Do(req, &Response{})
+			var nerr *NetError
+			if !errors.As(err, &nerr) {
+				t.Fatalf("Do() error = %v, want *NetError", err)
+			}
+			if !errors.Is(err, tt.wantKind) || nerr.Phase != tt.wantPhase || nerr.Addr != tt.wantAddr {
+				t.Errorf("Do() error = %s/%s/%s, want %s/%s/%s", nerr.Kind, nerr.Phase, nerr.Addr, tt.wantKind, tt.wantPhase, tt.wantAddr)
+			}
+			if nerr.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", nerr.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestStaleConnError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"read eof", &NetError{Kind: NetRead, Phase: PhaseRead, Err: io.EOF}, true},
+		{"write reset", &NetError{Kind: NetWrite, Phase: PhaseWrite, Err: syscall.ECONNRESET}, true},
+		{"read timeout", &NetError{Kind: NetReadTimeout, Phase: PhaseRead, Err: &timeoutError{}}, false},
+		{"dial", &NetError{Kind: NetConnect, Phase: PhaseDial, Err: io.EOF}, false},
+		{"not a NetError", io.EOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := staleConnError(tt.err)
+			if got := errors.Is(err, NetStaleConn); got != tt.want {
+				t.Errorf("staleConnError() = %v, want stale %t", err, tt.want)
+			}
+			if !tt.want && err != tt.err {
+				t.Errorf("staleConnError() = %v, want it unchanged", err)
+			}
+		})
+	}
+}
+
+func TestClient_Do_StaleConnRedialFails(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		rawhttptest.Close(),
+	})
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: srv.URL + "/"}
+	if err := client.Do(req, &Response{}); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	// the pooled connection is stale and nothing accepts a new one
+	srv.Conn(0).Wait()
+	srv.Close()
+
+	req = &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: srv.URL + "/"}
+	err := client.Do(req, &Response{})
+	var nerr *NetError
+	if !errors.As(err, &nerr) || nerr.Kind != NetStaleConn || !errors.Is(err, NetConnectRefused) {
+		t.Errorf("Do() error = %v, want a stale connection and the refused dial", err)
+	}
+}
+
+func TestClient_Do_BodySourceSkipsPool(t *testing.T) {
+	srv := rawhttptest.NewServer(
+		rawhttptest.Script{
+			rawhttptest.ExpectRequest(),
+			rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+			rawhttptest.Sleep(20 * time.Millisecond),
+			rawhttptest.Close(),
+		},
+		rawhttptest.Script{
+			rawhttptest.Expect("body"),
+			rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		},
+	)
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: srv.URL + "/"}
+	if err := client.Do(req, &Response{}); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	// the pooled connection is stale now
+	srv.Conn(0).Wait()
+
+	req = &Request{Rawdata: []byte("POST / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: srv.URL + "/"}
+	req.SetBodySource(&BodySource{Reader: strings.NewReader("body"), Size: 4})
+	resp := &Response{}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	if resp.StatusCode() != 200 || len(srv.Conns()) != 2 {
+		t.Errorf("StatusCode() = %d over %d connections, want 200 over a new connection", resp.StatusCode(), len(srv.Conns()))
+	}
+}
@@ -4,6 +4,8 @@ go 1.24.0
 
 require (
 	github.com/andybalholm/brotli v1.2.0
+	github.com/klauspost/compress v1.18.0
 	github.com/vodafon/vgutils v0.0.0-20201031081340-1b6be1866ddb
 	golang.org/x/net v0.49.0
+	golang.org/x/text v0.33.0
 )
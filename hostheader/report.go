@@ -0,0 +1,132 @@
+package hostheader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/vodafon/rawhttp"
+)
+
+// Result compares the response to one variant with the baseline.
+type Result struct {
+	Variant  Variant
+	Response *rawhttp.Response
+	Err      error
+
+	StatusCode     int
+	StatusChanged  bool
+	LengthDelta    int
+	ChangedHeaders []string
+	// Reflected is set when the attacker host appears in the response but
+	// not in the baseline.
+	Reflected bool
+	// BodyErr is set when a body could not be decoded or exceeded
+	// MaxDecodedBytes. The comparison then uses the body as received.
+	BodyErr error
+}
+
+// Interesting reports whether the variant behaved differently from the
+// baseline.
+func (obj Result) Interesting() bool {
+	return obj.Err == nil && (obj.StatusChanged || obj.Reflected || len(obj.ChangedHeaders) > 0 || obj.LengthDelta != 0)
+}
+
+// Tester sends the base request and its variants.
+type Tester struct {
+	Client *rawhttp.Client
+	// Base is a parsed request with its URL and optional IP set. It is
+	// not modified.
+	Base *rawhttp.Request
+	// Attacker is the injected host. Default: DefaultAttacker.
+	Attacker string
+}
+
+// Run sends the baseline, then every variant, and compares each response
+// with the baseline. Errors of single variants are recorded in the result;
+// an error is returned only when the baseline fails.
+func (obj *Tester) Run() (*rawhttp.Response, []Result, error) {
+	attacker := obj.Attacker
+	if attacker == "" {
+		attacker = DefaultAttacker
+	}
+	variants, err := Generate(obj.Base, attacker)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseline := rawhttp.NewResponse()
+	if err := obj.Client.Do(obj.Base.Clone(), baseline); err != nil {
+		return nil, nil, fmt.Errorf("baseline: %w", err)
+	}
+	if err := baseline.ParseRawdata(); err != nil && !baseline.BodyError() {
+		return nil, nil, fmt.Errorf("baseline: %w", err)
+	}
+
+	results := make([]Result, 0, len(variants))
+	for _, v := range variants {
+		resp := rawhttp.NewResponse()
+		res := Result{Variant: v, Response: resp}
+		if res.Err = obj.Client.Do(v.Request, resp); res.Err == nil {
+			res = Compare(baseline, resp, attacker)
+			res.Variant = v
+		}
+		results = append(results, res)
+	}
+	return baseline, results, nil
+}
+
+// Compare compares resp with the baseline using rawhttp.DiffResponses.
+// Headers listed in rawhttp.DefaultIgnoreHeaders are ignored.
+func Compare(baseline, resp *rawhttp.Response, attacker string) Result {
+	res := Result{Response: resp}
+	d, err := rawhttp.DiffResponses(baseline, resp, rawhttp.DiffOptions{IgnoreHeaders: rawhttp.DefaultIgnoreHeaders})
+	if d == nil {
+		res.Err = err
+		return res
+	}
+	res.BodyErr = err
+
+	res.StatusCode = d.ProbeStatus
+	res.StatusChanged = d.StatusChanged
+	res.LengthDelta = d.LengthDelta
+	res.ChangedHeaders = append(res.ChangedHeaders, d.AddedHeaders...)
+	res.ChangedHeaders = append(res.ChangedHeaders, d.RemovedHeaders...)
+	for _, h := range d.ChangedHeaders {
+		res.ChangedHeaders = append(res.ChangedHeaders, h.Name)
+	}
+	slices.Sort(res.ChangedHeaders)
+	res.Reflected = bytes.Contains(resp.Bytes(), []byte(attacker)) && !bytes.Contains(baseline.Bytes(), []byte(attacker))
+	return res
+}
+
+// WriteReport writes one line per result, interesting variants first.
+func WriteReport(w io.Writer, baseline *rawhttp.Response, results []Result) error {
+	if _, err := fmt.Fprintf(w, "%-32s status=%d length=%d\n", "baseline", baseline.StatusCode(), len(baseline.Body())); err != nil {
+		return err
+	}
+	for _, pass := range []bool{true, false} {
+		for _, r := range results {
+			if r.Interesting() != pass {
+				continue
+			}
+			var line string
+			if r.Err != nil {
+				line = fmt.Sprintf("%-32s error: %v\n", r.Variant.Name, r.Err)
+			} else {
+				line = fmt.Sprintf("%-32s status=%d length%+d reflected=%t headers=%s",
+					r.Variant.Name, r.StatusCode, r.LengthDelta, r.Reflected, strings.Join(r.ChangedHeaders, ","))
+				if r.BodyErr != nil {
+					line += fmt.Sprintf(" body error: %v", r.BodyErr)
+				}
+				line += "\n"
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package hostheader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp"
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func reply(headers, body string) rawhttptest.Script {
+	return rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write(fmt.Sprintf("HTTP/1.1 200 OK\r\nDate: now\r\n%sContent-Length: %d\r\n\r\n%s", headers, len(body), body)),
+	}
+}
+
+func TestTester_Run(t *testing.T) {
+	srv := rawhttptest.NewServer(
+		reply("", "home"),
+		// attacker-host: reflected in a redirect
+		rawhttptest.Script{
+			rawhttptest.ExpectRequest(),
+			rawhttptest.Write("HTTP/1.1 302 Found\r\nDate: later\r\nLocation: http://evil.test/\r\nContent-Length: 0\r\n\r\n"),
+		},
+		reply("", "home"),
+	)
+	defer srv.Close()
+
+	client := rawhttp.NewDefaultClient()
+	client.DisableKeepAlive = true
+	defer client.Close()
+
+	base := &rawhttp.Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	if err := base.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	tester := &Tester{Client: client, Base: base, Attacker: "evil.test"}
+	baseline, results, err := tester.Run()
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if baseline.StatusCode() != 200 {
+		t.Errorf("baseline status = %d", baseline.StatusCode())
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: error %v", r.Variant.Name, r.Err)
+			continue
+		}
+		if r.Variant.Name == "attacker-host" {
+			if !r.Interesting() || !r.StatusChanged || !r.Reflected || r.LengthDelta != -4 ||
+				strings.Join(r.ChangedHeaders, ",") != "Location" {
+				t.Errorf("attacker-host result = %+v", r)
+			}
+			continue
+		}
+		if r.Interesting() {
+			t.Errorf("%s: unexpected difference %+v", r.Variant.Name, r)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, baseline, results); err != nil {
+		t.Fatalf("WriteReport() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(results)+1 || !strings.HasPrefix(lines[1], "attacker-host ") {
+		t.Errorf("report = %q", buf.String())
+	}
+}
+
+func TestCompare_BodyError(t *testing.T) {
+	baseline := &rawhttp.Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nhome")}
+	resp := &rawhttp.Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: 7\r\n\r\nnotgzip")}
+
+	r := Compare(baseline, resp, "evil.test")
+	var encErr *rawhttp.ContentEncodingError
+	if r.Err != nil || !errors.As(r.BodyErr, &encErr) {
+		t.Fatalf("Err = %v, BodyErr = %v, want a body error only", r.Err, r.BodyErr)
+	}
+	if r.StatusCode != 200 || r.LengthDelta != 3 || strings.Join(r.ChangedHeaders, ",") != "Content-Encoding" || !r.Interesting() {
+		t.Errorf("result = %+v", r)
+	}
+}
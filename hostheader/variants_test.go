@@ -0,0 +1,76 @@
+package hostheader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp"
+)
+
+func TestGenerate(t *testing.T) {
+	base := &rawhttp.Request{
+		Rawdata: []byte("GET /a?b=1 HTTP/1.1\r\nHost: example.com:8080\r\nAccept: */*\r\n\r\n"),
+		URL:     "http://example.com:8080/a?b=1",
+		IP:      "10.0.0.1",
+	}
+	if err := base.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+	orig := string(base.Bytes())
+
+	variants, err := Generate(base, "evil.test")
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+
+	want := map[string]string{
+		"attacker-host":         "GET /a?b=1 HTTP/1.1\r\nHost: evil.test\r\nAccept: */*\r\n\r\n",
+		"duplicate-host":        "GET /a?b=1 HTTP/1.1\r\nHost: example.com:8080\r\nAccept: */*\r\nHost: evil.test\r\n\r\n",
+		"duplicate-host-first":  "GET /a?b=1 HTTP/1.1\r\nHost: evil.test\r\nAccept: */*\r\nHost: example.com:8080\r\n\r\n",
+		"absolute-uri":          "GET http://example.com:8080/a?b=1 HTTP/1.1\r\nHost: evil.test\r\nAccept: */*\r\n\r\n",
+		"absolute-uri-attacker": "GET http://evil.test/a?b=1 HTTP/1.1\r\nHost: example.com:8080\r\nAccept: */*\r\n\r\n",
+		"port-injection":        "GET /a?b=1 HTTP/1.1\r\nHost: example.com:31337\r\nAccept: */*\r\n\r\n",
+		"port-payload":          "GET /a?b=1 HTTP/1.1\r\nHost: example.com:evil.test\r\nAccept: */*\r\n\r\n",
+		"line-wrapped":          "GET /a?b=1 HTTP/1.1\r\n Host: evil.test\r\nHost: example.com:8080\r\nAccept: */*\r\n\r\n",
+		"folded":                "GET /a?b=1 HTTP/1.1\r\nHost: example.com:8080\r\n evil.test\r\nAccept: */*\r\n\r\n",
+		"override-X-Forwarded-Host": "GET /a?b=1 HTTP/1.1\r\nHost: example.com:8080\r\nAccept: */*\r\n" +
+			"X-Forwarded-Host: evil.test\r\n\r\n",
+		"override-Forwarded": "GET /a?b=1 HTTP/1.1\r\nHost: example.com:8080\r\nAccept: */*\r\n" +
+			"Forwarded: host=evil.test\r\n\r\n",
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range variants {
+		if seen[v.Name] {
+			t.Errorf("duplicate variant name %q", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Request.IP != "10.0.0.1" || v.Request.URL != base.URL {
+			t.Errorf("%s: IP = %q, URL = %q", v.Name, v.Request.IP, v.Request.URL)
+		}
+		if w, ok := want[v.Name]; ok {
+			if got := string(v.Request.Bytes()); got != w {
+				t.Errorf("%s: Bytes() = %q, want %q", v.Name, got, w)
+			}
+		} else if !strings.Contains(string(v.Request.Bytes()), "evil.test") {
+			t.Errorf("%s: attacker host missing", v.Name)
+		}
+	}
+	for name := range want {
+		if !seen[name] {
+			t.Errorf("variant %q not generated", name)
+		}
+	}
+
+	if got := string(base.Bytes()); got != orig {
+		t.Errorf("base modified: %q", got)
+	}
+}
+
+func TestGenerate_InvalidURL(t *testing.T) {
+	base := &rawhttp.Request{Rawdata: []byte("GET / HTTP/1.1\r\n\r\n"), URL: "/relative"}
+	base.ParseRawdata()
+	if _, err := Generate(base, ""); err != rawhttp.InvalidURLError {
+		t.Errorf("Generate() error = %v, want InvalidURLError", err)
+	}
+}
@@ -0,0 +1,342 @@
+package rawhttp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// AttackMode selects how payloads are combined across marked positions.
+type AttackMode int
+
+const (
+	// Sniper places each payload of Intruder.Payload into one position at
+	// a time; the other positions get their Defaults.
+	Sniper AttackMode = iota
+	// BatteringRam places the same payload of Intruder.Payload into every
+	// position at once.
+	BatteringRam
+	// Pitchfork walks the per-position sets of Intruder.Payloads in
+	// lockstep and stops at the shortest one.
+	Pitchfork
+	// ClusterBomb tries every combination of the per-position sets of
+	// Intruder.Payloads. The last position varies fastest.
+	ClusterBomb
+)
+
+const (
+	// PayloadMarker delimits payload positions in a template, e.g. §user§.
+	PayloadMarker = "§"
+
+	DefaultIntruderWorkers = 10
+)
+
+// PayloadSet is an indexed list of payloads.
+type PayloadSet interface {
+	Len() int
+	Payload(i int) []byte
+}
+
+type wordlist [][]byte
+
+func (obj wordlist) Len() int             { return len(obj) }
+func (obj wordlist) Payload(i int) []byte { return obj[i] }
+
+// Wordlist returns a payload set with the given words.
+func Wordlist(words ...string) PayloadSet {
+	wl := make(wordlist, len(words))
+	for i, w := range words {
+		wl[i] = []byte(w)
+	}
+	return wl
+}
+
+// WordlistFile loads one payload per line from a file. Trailing "\r" is
+// stripped and empty lines are skipped.
+func WordlistFile(name string) (PayloadSet, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var wl wordlist
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
+		if len(line) == 0 {
+			continue
+		}
+		wl = append(wl, append([]byte(nil), line...))
+	}
+	return wl, scanner.Err()
+}
+
+type numberRange struct {
+	from, step, n int
+	format        string
+}
+
+func (obj numberRange) Len() int { return obj.n }
+
+func (obj numberRange) Payload(i int) []byte {
+	v := obj.from + i*obj.step
+	if obj.format == "" {
+		return []byte(strconv.Itoa(v))
+	}
+	return []byte(fmt.Sprintf(obj.format, v))
+}
+
+// NumberRange returns the numbers from..to inclusive, advancing by step.
+// A zero step is treated as 1 or -1 depending on direction.
+func NumberRange(from, to, step int) PayloadSet {
+	return NumberRangeFormat(from, to, step, "")
+}
+
+// NumberRangeFormat is like NumberRange but formats each number with a
+// fmt verb such as "%04d" or "%x".
+func NumberRangeFormat(from, to, step int, format string) PayloadSet {
+	if step == 0 {
+		step = 1
+		if to < from {
+			step = -1
+		}
+	}
+	n := 0
+	if (step > 0 && to >= from) || (step < 0 && to <= from) {
+		n = (to-from)/step + 1
+	}
+	return numberRange{from: from, step: step, n: n, format: format}
+}
+
+type payloadFunc struct {
+	n  int
+	fn func(i int) []byte
+}
+
+func (obj payloadFunc) Len() int             { return obj.n }
+func (obj payloadFunc) Payload(i int) []byte { return obj.fn(i) }
+
+// PayloadFunc returns a set of n payloads produced on demand by fn.
+func PayloadFunc(n int, fn func(i int) []byte) PayloadSet {
+	return payloadFunc{n: n, fn: fn}
+}
+
+// Intruder sends variants of a template request with payloads inserted at
+// §name§ positions in Template.Rawdata. A name may be used several times;
+// every occurrence receives the same payload. Each variant is a fresh
+// Request, so ||CLEN|| and other template variables are resolved by the
+// client after substitution.
+type Intruder struct {
+	Client   *Client  // Default: NewClientTransferVariables
+	Template *Request // Rawdata with markers; URL and IP are copied to variants
+	Mode     AttackMode
+
+	// Payload is used by Sniper and BatteringRam.
+	Payload PayloadSet
+	// Payloads holds one set per position name for Pitchfork and ClusterBomb.
+	Payloads map[string]PayloadSet
+	// Defaults is the value of a position that is not under attack in
+	// Sniper mode. Unset positions are left empty.
+	Defaults map[string][]byte
+
+	// Workers is the number of concurrent requests. Default: DefaultIntruderWorkers.
+	Workers int
+}
+
+// IntruderResult is delivered for every variant sent.
+type IntruderResult struct {
+	Index    int
+	Position string            // Sniper only: the position under attack
+	Payloads map[string][]byte // value placed at each position
+	Request  *Request
+	Response *Response
+	Err      error
+}
+
+type intruderTemplate struct {
+	segments  [][]byte // literal text; segment i is followed by position slots[i]
+	slots     []string
+	positions []string // distinct names in order of first appearance
+}
+
+func parseIntruderTemplate(data []byte) (*intruderTemplate, error) {
+	parts := bytes.Split(data, []byte(PayloadMarker))
+	if len(parts)%2 == 0 {
+		return nil, fmt.Errorf("unbalanced payload marker %s in template", PayloadMarker)
+	}
+
+	t := &intruderTemplate{}
+	seen := make(map[string]bool)
+	for i, part := range parts {
+		if i%2 == 0 {
+			t.segments = append(t.segments, part)
+			continue
+		}
+		name := string(part)
+		t.slots = append(t.slots, name)
+		if !seen[name] {
+			seen[name] = true
+			t.positions = append(t.positions, name)
+		}
+	}
+	if len(t.positions) == 0 {
+		return nil, fmt.Errorf("template has no payload positions")
+	}
+	return t, nil
+}
+
+func (obj *intruderTemplate) render(values map[string][]byte) []byte {
+	var buf bytes.Buffer
+	for i, seg := range obj.segments {
+		buf.Write(seg)
+		if i < len(obj.slots) {
+			buf.Write(values[obj.slots[i]])
+		}
+	}
+	return buf.Bytes()
+}
+
+type intruderJob struct {
+	index    int
+	position string
+	values   map[string][]byte
+}
+
+// jobs returns the number of variants and a function building the i-th one.
+func (obj *Intruder) jobs(t *intruderTemplate) (int, func(i int) intruderJob, error) {
+	switch obj.Mode {
+	case Sniper:
+		if obj.Payload == nil {
+			return 0, nil, fmt.Errorf("sniper attack requires Payload")
+		}
+		per := obj.Payload.Len()
+		return per * len(t.positions), func(i int) intruderJob {
+			pos := t.positions[i/per]
+			values := make(map[string][]byte, len(t.positions))
+			for _, p := range t.positions {
+				values[p] = obj.Defaults[p]
+			}
+			values[pos] = obj.Payload.Payload(i % per)
+			return intruderJob{index: i, position: pos, values: values}
+		}, nil
+	case BatteringRam:
+		if obj.Payload == nil {
+			return 0, nil, fmt.Errorf("battering ram attack requires Payload")
+		}
+		return obj.Payload.Len(), func(i int) intruderJob {
+			payload := obj.Payload.Payload(i)
+			values := make(map[string][]byte, len(t.positions))
+			for _, p := range t.positions {
+				values[p] = payload
+			}
+			return intruderJob{index: i, values: values}
+		}, nil
+	case Pitchfork, ClusterBomb:
+		sets := make([]PayloadSet, len(t.positions))
+		for i, p := range t.positions {
+			set, ok := obj.Payloads[p]
+			if !ok {
+				return 0, nil, fmt.Errorf("no payload set for position %q", p)
+			}
+			sets[i] = set
+		}
+		if obj.Mode == Pitchfork {
+			n := sets[0].Len()
+			for _, s := range sets[1:] {
+				n = min(n, s.Len())
+			}
+			return n, func(i int) intruderJob {
+				values := make(map[string][]byte, len(t.positions))
+				for j, p := range t.positions {
+					values[p] = sets[j].Payload(i)
+				}
+				return intruderJob{index: i, values: values}
+			}, nil
+		}
+		n := 1
+		for _, s := range sets {
+			n *= s.Len()
+		}
+		return n, func(i int) intruderJob {
+			values := make(map[string][]byte, len(t.positions))
+			rest := i
+			for j := len(sets) - 1; j >= 0; j-- {
+				l := sets[j].Len()
+				values[t.positions[j]] = sets[j].Payload(rest % l)
+				rest /= l
+			}
+			return intruderJob{index: i, values: values}
+		}, nil
+	}
+	return 0, nil, fmt.Errorf("unknown attack mode %d", obj.Mode)
+}
+
+// Run sends every variant and calls fn with each result as it completes.
+// Calls to fn are serialized. Run returns an error only when the attack
+// cannot be set up; per-request failures are reported in IntruderResult.Err.
+func (obj *Intruder) Run(fn func(*IntruderResult)) error {
+	if obj.Template == nil {
+		return fmt.Errorf("intruder requires a Template")
+	}
+	t, err := parseIntruderTemplate(obj.Template.Rawdata)
+	if err != nil {
+		return err
+	}
+	total, job, err := obj.jobs(t)
+	if err != nil {
+		return err
+	}
+
+	client := obj.Client
+	if client == nil {
+		client = NewClientTransferVariables()
+		defer client.Close()
+	}
+	workers := obj.Workers
+	if workers <= 0 {
+		workers = DefaultIntruderWorkers
+	}
+
+	indexes := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				j := job(i)
+				req := &Request{
+					Rawdata: t.render(j.values),
+					URL:     obj.Template.URL,
+					IP:      obj.Template.IP,
+				}
+				resp := client.NewResponse()
+				err := client.Do(req, resp)
+
+				mu.Lock()
+				fn(&IntruderResult{
+					Index:    j.index,
+					Position: j.position,
+					Payloads: j.values,
+					Request:  req,
+					Response: resp,
+					Err:      err,
+				})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < total; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,195 @@
+package rawhttp
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestPayloadSets(t *testing.T) {
+	tests := []struct {
+		name string
+		set  PayloadSet
+		want []string
+	}{
+		{"wordlist", Wordlist("a", "b"), []string{"a", "b"}},
+		{"range", NumberRange(1, 3, 1), []string{"1", "2", "3"}},
+		{"range step", NumberRange(0, 10, 5), []string{"0", "5", "10"}},
+		{"range descending zero step", NumberRange(3, 1, 0), []string{"3", "2", "1"}},
+		{"range empty", NumberRange(3, 1, 1), nil},
+		{"range format", NumberRangeFormat(9, 11, 1, "%03d"), []string{"009", "010", "011"}},
+		{"func", PayloadFunc(2, func(i int) []byte { return []byte(strings.Repeat("x", i+1)) }), []string{"x", "xx"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for i := 0; i < tt.set.Len(); i++ {
+				got = append(got, string(tt.set.Payload(i)))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("payloads = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordlistFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "words.txt")
+	os.WriteFile(name, []byte("admin\r\n\nroot\nguest"), 0o644)
+
+	set, err := WordlistFile(name)
+	if err != nil {
+		t.Fatalf("WordlistFile() error: %v", err)
+	}
+	if set.Len() != 3 || string(set.Payload(0)) != "admin" || string(set.Payload(2)) != "guest" {
+		t.Errorf("WordlistFile() = %d payloads, first %q", set.Len(), set.Payload(0))
+	}
+}
+
+func TestParseIntruderTemplate(t *testing.T) {
+	tmpl, err := parseIntruderTemplate([]byte("a=§x§&b=§y§&c=§x§"))
+	if err != nil {
+		t.Fatalf("parseIntruderTemplate() error: %v", err)
+	}
+	if strings.Join(tmpl.positions, ",") != "x,y" {
+		t.Errorf("positions = %v, want [x y]", tmpl.positions)
+	}
+	got := tmpl.render(map[string][]byte{"x": []byte("1"), "y": []byte("2")})
+	if string(got) != "a=1&b=2&c=1" {
+		t.Errorf("render() = %q", got)
+	}
+
+	if _, err := parseIntruderTemplate([]byte("a=§x")); err == nil {
+		t.Error("expected error for unbalanced marker")
+	}
+	if _, err := parseIntruderTemplate([]byte("no markers")); err == nil {
+		t.Error("expected error for template without positions")
+	}
+}
+
+func TestIntruder_Jobs(t *testing.T) {
+	tmpl, _ := parseIntruderTemplate([]byte("§a§-§b§"))
+
+	render := func(in *Intruder) []string {
+		n, job, err := in.jobs(tmpl)
+		if err != nil {
+			t.Fatalf("jobs() error: %v", err)
+		}
+		var out []string
+		for i := 0; i < n; i++ {
+			out = append(out, string(tmpl.render(job(i).values)))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		intruder *Intruder
+		want     []string
+	}{
+		{
+			name: "sniper",
+			intruder: &Intruder{
+				Mode:     Sniper,
+				Payload:  Wordlist("1", "2"),
+				Defaults: map[string][]byte{"a": []byte("A"), "b": []byte("B")},
+			},
+			want: []string{"1-B", "2-B", "A-1", "A-2"},
+		},
+		{
+			name:     "battering ram",
+			intruder: &Intruder{Mode: BatteringRam, Payload: Wordlist("1", "2")},
+			want:     []string{"1-1", "2-2"},
+		},
+		{
+			name: "pitchfork",
+			intruder: &Intruder{Mode: Pitchfork, Payloads: map[string]PayloadSet{
+				"a": Wordlist("x", "y", "z"),
+				"b": NumberRange(1, 2, 1),
+			}},
+			want: []string{"x-1", "y-2"},
+		},
+		{
+			name: "cluster bomb",
+			intruder: &Intruder{Mode: ClusterBomb, Payloads: map[string]PayloadSet{
+				"a": Wordlist("x", "y"),
+				"b": NumberRange(1, 2, 1),
+			}},
+			want: []string{"x-1", "x-2", "y-1", "y-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := render(tt.intruder)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("variants = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := (&Intruder{Mode: ClusterBomb, Payloads: map[string]PayloadSet{"a": Wordlist("x")}}).jobs(tmpl); err == nil {
+		t.Error("expected error for missing payload set")
+	}
+	if _, _, err := (&Intruder{Mode: Sniper}).jobs(tmpl); err == nil {
+		t.Error("expected error for missing sniper payload")
+	}
+}
+
+func TestIntruder_Run(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\n\r\nok"),
+		rawhttptest.Close(),
+	})
+	defer srv.Close()
+
+	in := &Intruder{
+		Template: &Request{
+			Rawdata: []byte("POST /login HTTP/1.1\r\nHost: ||HOST||\r\nContent-Length: ||CLEN||\r\n\r\nuser=§user§"),
+			URL:     srv.URL + "/login",
+		},
+		Mode:    BatteringRam,
+		Payload: Wordlist("a", "admin", "administrator"),
+		Workers: 2,
+	}
+
+	var users []string
+	err := in.Run(func(res *IntruderResult) {
+		if res.Err != nil {
+			t.Errorf("result %d error: %v", res.Index, res.Err)
+			return
+		}
+		if res.Response.StatusCode() != 200 {
+			t.Errorf("result %d status = %d", res.Index, res.Response.StatusCode())
+		}
+		users = append(users, string(res.Payloads["user"]))
+	})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	sort.Strings(users)
+	if strings.Join(users, ",") != "a,admin,administrator" {
+		t.Errorf("payloads = %v", users)
+	}
+
+	re := regexp.MustCompile(`Content-Length: (\d+)\r\n\r\n(user=\w+)$`)
+	for _, c := range srv.Conns() {
+		m := re.FindStringSubmatch(string(c.Received()))
+		if m == nil {
+			t.Errorf("unexpected request %q", c.Received())
+			continue
+		}
+		if m[1] != strconv.Itoa(len(m[2])) {
+			t.Errorf("Content-Length = %s for body %q", m[1], m[2])
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package rawhttp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// Length markers are resolved after every other template variable, so the
+// lengths match the bytes that are actually sent:
+//
+//	||CLEN||            length of the whole body, decimal
+//	||CLENHEX||         length of the whole body, hex
+//	||BEGIN:name||      start of a named region of the body
+//	||END:name||        end of that region
+//	||CLEN:name||       length of the region, decimal
+//	||CLENHEX:name||    length of the region, hex
+//
+// Region markers are removed from the output and may only appear in the
+// body. Regions can be nested but must not overlap. Length placeholders may
+// appear anywhere in the request, including inside the regions they measure.
+
+// LengthMarkerError reports a malformed length region.
+type LengthMarkerError struct {
+	Name   string
+	Reason string
+}
+
+func (obj *LengthMarkerError) Error() string {
+	return fmt.Sprintf("length marker %q: %s", obj.Name, obj.Reason)
+}
+
+type lengthPieceKind int
+
+const (
+	pieceLiteral lengthPieceKind = iota
+	pieceLength
+	pieceBegin
+	pieceEnd
+)
+
+type lengthPiece struct {
+	kind lengthPieceKind
+	data []byte // pieceLiteral
+	name string // region name, "" for the whole body
+	hex  bool
+}
+
+// maxLengthIterations bounds the fixpoint search. Each round can only
+// change the number of digits of a placeholder, so a handful is plenty.
+const maxLengthIterations = 16
+
+// parseLengthPieces splits data into literals and length markers. Escaped
+// delimiters (\||) become literal "||".
+func parseLengthPieces(data []byte) []lengthPiece {
+	var pieces []lengthPiece
+	var lit bytes.Buffer
+	flush := func() {
+		if lit.Len() > 0 {
+			pieces = append(pieces, lengthPiece{kind: pieceLiteral, data: append([]byte(nil), lit.Bytes()...)})
+			lit.Reset()
+		}
+	}
+
+	i := 0
+	for i < len(data) {
+		rest := data[i:]
+		if bytes.HasPrefix(rest, variableEsc) {
+			lit.Write(variableDelim)
+			i += len(variableEsc)
+			continue
+		}
+		if bytes.HasPrefix(rest, variableDelim) {
+			if p, n, ok := parseLengthMarker(rest); ok {
+				flush()
+				pieces = append(pieces, p)
+				i += n
+				continue
+			}
+			lit.Write(variableDelim)
+			i += len(variableDelim)
+			continue
+		}
+		lit.WriteByte(data[i])
+		i++
+	}
+	flush()
+	return pieces
+}
+
+func parseLengthMarker(data []byte) (lengthPiece, int, bool) {
+	end := bytes.Index(data[len(variableDelim):], variableDelim)
+	if end == -1 {
+		return lengthPiece{}, 0, false
+	}
+	token := string(data[len(variableDelim) : len(variableDelim)+end])
+	n := end + 2*len(variableDelim)
+
+	kind, name, hasName := token, "", false
+	if idx := bytes.IndexByte([]byte(token), ':'); idx != -1 {
+		kind, name, hasName = token[:idx], token[idx+1:], true
+		if name == "" {
+			return lengthPiece{}, 0, false
+		}
+		for j := 0; j < len(name); j++ {
+			if !isVariableNameByte(name[j]) {
+				return lengthPiece{}, 0, false
+			}
+		}
+	}
+
+	switch kind {
+	case "CLEN":
+		return lengthPiece{kind: pieceLength, name: name}, n, true
+	case "CLENHEX":
+		return lengthPiece{kind: pieceLength, name: name, hex: true}, n, true
+	case "BEGIN":
+		if hasName {
+			return lengthPiece{kind: pieceBegin, name: name}, n, true
+		}
+	case "END":
+		if hasName {
+			return lengthPiece{kind: pieceEnd, name: name}, n, true
+		}
+	}
+	return lengthPiece{}, 0, false
+}
+
+// validateLengthRegions checks the region markers of the body and returns
+// the set of region names.
+func validateLengthRegions(body []lengthPiece) (map[string]bool, error) {
+	names := make(map[string]bool)
+	var stack []string
+	for _, p := range body {
+		switch p.kind {
+		case pieceBegin:
+			if names[p.name] {
+				return nil, &LengthMarkerError{Name: p.name, Reason: "region defined twice"}
+			}
+			names[p.name] = true
+			stack = append(stack, p.name)
+		case pieceEnd:
+			if len(stack) > 0 && stack[len(stack)-1] == p.name {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			for _, open := range stack {
+				if open == p.name {
+					return nil, &LengthMarkerError{Name: p.name, Reason: fmt.Sprintf("region overlaps %q", stack[len(stack)-1])}
+				}
+			}
+			return nil, &LengthMarkerError{Name: p.name, Reason: "end without begin"}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, &LengthMarkerError{Name: stack[len(stack)-1], Reason: "unterminated region"}
+	}
+	return names, nil
+}
+
+// resolveLengths replaces the length markers in parts. body is the index of
+// the part holding the request body, or -1 when there is none. A bodyLen of
+// zero or more is used for the whole-body length instead of measuring the
+// body part.
+func resolveLengths(parts [][]byte, body, bodyLen int) ([][]byte, error) {
+	pieces := make([][]lengthPiece, len(parts))
+	for i, part := range parts {
+		pieces[i] = parseLengthPieces(part)
+	}
+
+	var regions map[string]bool
+	if body >= 0 {
+		var err error
+		regions, err = validateLengthRegions(pieces[body])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, ps := range pieces {
+		for _, p := range ps {
+			if i != body && (p.kind == pieceBegin || p.kind == pieceEnd) {
+				return nil, &LengthMarkerError{Name: p.name, Reason: "region markers are only allowed in the body"}
+			}
+			if p.kind == pieceLength && p.name != "" && !regions[p.name] {
+				return nil, &LengthMarkerError{Name: p.name, Reason: "unknown region"}
+			}
+		}
+	}
+
+	lengths := make(map[string]int)
+	if bodyLen >= 0 {
+		lengths[""] = bodyLen
+	}
+	out := make([][]byte, len(parts))
+	for iter := 0; iter < maxLengthIterations; iter++ {
+		next := make(map[string]int)
+		if bodyLen >= 0 {
+			next[""] = bodyLen
+		}
+		for i, ps := range pieces {
+			var starts map[string]int
+			if i == body {
+				starts = make(map[string]int)
+			}
+			var buf bytes.Buffer
+			for _, p := range ps {
+				switch p.kind {
+				case pieceLiteral:
+					buf.Write(p.data)
+				case pieceLength:
+					if p.hex {
+						buf.WriteString(strconv.FormatInt(int64(lengths[p.name]), 16))
+					} else {
+						buf.WriteString(strconv.Itoa(lengths[p.name]))
+					}
+				case pieceBegin:
+					starts[p.name] = buf.Len()
+				case pieceEnd:
+					next[p.name] = buf.Len() - starts[p.name]
+				}
+			}
+			out[i] = buf.Bytes()
+			if i == body && bodyLen < 0 {
+				next[""] = buf.Len()
+			}
+		}
+		if sameLengths(lengths, next) {
+			return out, nil
+		}
+		lengths = next
+	}
+	return nil, &LengthMarkerError{Reason: "lengths do not converge"}
+}
+
+func sameLengths(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveLengthMarkers resolves the length markers of a parsed request in
+// place. PrepareRequestVariables calls it after expanding all other
+// variables; the request is left unchanged when an error is returned. With
+// a body source the whole-body length is BodySource.Size.
+func ResolveLengthMarkers(req *Request) error {
+	keys := make([]string, 0, len(req.headers))
+	parts := [][]byte{req.body, req.method, req.path, req.version, req.httpLine}
+	for k, v := range req.headers {
+		keys = append(keys, k)
+		parts = append(parts, v.Key, v.Value, v.Raw)
+	}
+
+	bodyLen := -1
+	if req.rawBody {
+		parts[0] = nil
+		bodyLen = len(req.body)
+	}
+	if src := req.bodySource; src != nil {
+		if src.Size < 0 && hasBodyLengthMarker(parts) {
+			return &LengthMarkerError{Reason: "body source size unknown"}
+		}
+		bodyLen = int(max(src.Size, 0))
+	}
+	out, err := resolveLengths(parts, 0, bodyLen)
+	if err != nil {
+		return err
+	}
+
+	if !req.rawBody {
+		req.body = out[0]
+	}
+	req.method, req.path, req.version = out[1], out[2], out[3]
+	if req.httpLine != nil {
+		req.httpLine = out[4]
+	}
+	for i, k := range keys {
+		hl := req.headers[k]
+		hl.Key = out[5+3*i]
+		hl.Value = out[6+3*i]
+		if hl.Raw != nil {
+			hl.Raw = out[7+3*i]
+		}
+		req.headers[k] = hl
+	}
+	return nil
+}
+
+// hasBodyLengthMarker reports whether parts use ||CLEN|| or ||CLENHEX||.
+func hasBodyLengthMarker(parts [][]byte) bool {
+	for _, part := range parts {
+		for _, p := range parseLengthPieces(part) {
+			if p.kind == pieceLength && p.name == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveRawLengthMarkers resolves the length markers of a raw request.
+// The body is everything after the first empty line, excluding trailing
+// whitespace.
+func resolveRawLengthMarkers(data []byte) ([]byte, error) {
+	sep := []byte("\r\n\r\n")
+	trimmed := bytes.TrimSpace(data)
+	idx := bytes.Index(trimmed, sep)
+	if idx == -1 {
+		out, err := resolveLengths([][]byte{data}, -1, -1)
+		if err != nil {
+			return nil, err
+		}
+		return out[0], nil
+	}
+
+	lead := len(data) - len(bytes.TrimLeftFunc(data, unicode.IsSpace))
+	start := lead + idx + len(sep)
+	end := lead + len(trimmed)
+	out, err := resolveLengths([][]byte{data[:start], data[start:end], data[end:]}, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(out, nil), nil
+}
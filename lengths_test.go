@@ -0,0 +1,156 @@
+package rawhttp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPrepareRequestVariables_LengthMarkers(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		header     string
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name:       "whole body after substitution",
+			body:       "host=||HOST||",
+			header:     "||CLEN||",
+			wantBody:   "host=example.com",
+			wantHeader: "16",
+		},
+		{
+			name:       "body shortened by END",
+			body:       "abc||END||def",
+			header:     "||CLEN||",
+			wantBody:   "abc",
+			wantHeader: "3",
+		},
+		{
+			name:       "hex chunk size",
+			body:       "||CLENHEX:c||\r\n||BEGIN:c||abcdefghijklmnopqrstuvwxyz||END:c||\r\n0\r\n\r\n",
+			header:     "chunked",
+			wantBody:   "1a\r\nabcdefghijklmnopqrstuvwxyz\r\n0\r\n\r\n",
+			wantHeader: "chunked",
+		},
+		{
+			name: "nested smuggled request",
+			body: "0\r\n\r\n||BEGIN:inner||POST /x HTTP/1.1\r\nContent-Length: ||CLEN:payload||\r\n\r\n" +
+				"||BEGIN:payload||a=1||END:payload||||END:inner||",
+			header: "||CLEN||/||CLEN:inner||",
+			wantBody: "0\r\n\r\nPOST /x HTTP/1.1\r\nContent-Length: 3\r\n\r\n" +
+				"a=1",
+			wantHeader: "47/42",
+		},
+		{
+			name:       "placeholder inside its own region",
+			body:       "||BEGIN:r||len=||CLEN:r||||END:r||",
+			header:     "||CLEN:r||",
+			wantBody:   "len=5",
+			wantHeader: "5",
+		},
+		{
+			name:       "escaped marker",
+			body:       `a\||CLEN\||`,
+			header:     "||CLEN||",
+			wantBody:   "a||CLEN||",
+			wantHeader: "9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{
+				URL:  "https://example.com/",
+				body: []byte(tt.body),
+				headers: map[string]HeaderLine{
+					"x-len": {Key: []byte("X-Len"), Value: []byte(tt.header)},
+				},
+			}
+			req.URI, _ = parseTestURL(req.URL)
+
+			PrepareRequestVariables(req)
+
+			if req.prepareErr != nil {
+				t.Fatalf("prepareErr = %v", req.prepareErr)
+			}
+			if string(req.body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", req.body, tt.wantBody)
+			}
+			if got := string(req.headers["x-len"].Value); got != tt.wantHeader {
+				t.Errorf("header = %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestResolveLengthMarkers_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		header string
+	}{
+		{"overlap", "||BEGIN:a||x||BEGIN:b||y||END:a||z||END:b||", ""},
+		{"unterminated", "||BEGIN:a||x", ""},
+		{"end without begin", "x||END:a||", ""},
+		{"defined twice", "||BEGIN:a||||END:a||||BEGIN:a||||END:a||", ""},
+		{"unknown region", "x", "||CLEN:nope||"},
+		{"region in header", "x", "||BEGIN:a||"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{
+				body: []byte(tt.body),
+				headers: map[string]HeaderLine{
+					"x-len": {Key: []byte("X-Len"), Value: []byte(tt.header)},
+				},
+			}
+
+			err := ResolveLengthMarkers(req)
+			var lmErr *LengthMarkerError
+			if !errors.As(err, &lmErr) {
+				t.Fatalf("ResolveLengthMarkers() error = %v, want *LengthMarkerError", err)
+			}
+			if string(req.body) != tt.body {
+				t.Errorf("body changed on error: %q", req.body)
+			}
+		})
+	}
+}
+
+func TestContentLengthCalculation_Scoped(t *testing.T) {
+	req := &Request{Rawdata: []byte("POST / HTTP/1.1\r\nContent-Length: ||CLEN||\r\n\r\n" +
+		"a=||CLEN:v||&v=||BEGIN:v||hello||END:v||\r\n")}
+
+	ContentLengthCalculation(req)
+
+	want := "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\na=5&v=hello\r\n"
+	if string(req.Rawdata) != want {
+		t.Errorf("Rawdata = %q, want %q", req.Rawdata, want)
+	}
+
+	bad := "POST / HTTP/1.1\r\nContent-Length: ||CLEN||\r\n\r\n||BEGIN:c||x"
+	req = &Request{Rawdata: []byte(bad)}
+	ContentLengthCalculation(req)
+	if string(req.Rawdata) != bad {
+		t.Errorf("Rawdata = %q, want unchanged on error", req.Rawdata)
+	}
+}
+
+func TestClient_Do_InvalidLengthMarkers(t *testing.T) {
+	client := NewClientTransferVariables()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("POST / HTTP/1.1\r\nHost: x\r\n\r\n||BEGIN:a||body"),
+		URL:     "http://127.0.0.1:1/",
+	}
+	err := client.Do(req, client.NewResponse())
+
+	var lmErr *LengthMarkerError
+	if !errors.Is(err, InvalidRequestError) || !errors.As(err, &lmErr) {
+		t.Errorf("Do() error = %v, want InvalidRequestError wrapping *LengthMarkerError", err)
+	}
+}
@@ -0,0 +1,75 @@
+package rawhttp
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// LimitKind names the limit a response exceeded.
+type LimitKind int
+
+const (
+	// LimitResponse is Client.MaxResponseBytes.
+	LimitResponse LimitKind = iota
+	// LimitHeader is Client.MaxHeaderBytes.
+	LimitHeader
+	// LimitDecoded is Response.MaxDecodedBytes.
+	LimitDecoded
+)
+
+func (obj LimitKind) String() string {
+	switch obj {
+	case LimitResponse:
+		return "response"
+	case LimitHeader:
+		return "header"
+	case LimitDecoded:
+		return "decoded body"
+	}
+	return fmt.Sprintf("LimitKind(%d)", int(obj))
+}
+
+// LimitError reports a response cut off at a size limit. The response is
+// kept up to the limit and marked Truncated.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int
+}
+
+func (obj *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeds %d bytes", obj.Kind, obj.Limit)
+}
+
+// checkReadLimits enforces MaxResponseBytes and MaxHeaderBytes on the data
+// read so far, truncating resp.Rawdata at the exceeded limit.
+func (obj *Client) checkReadLimits(resp *Response) error {
+	if max := obj.MaxHeaderBytes; max > 0 && !resp.IsHTTP09() {
+		size := headerSize(resp.Rawdata)
+		if size == -1 && len(resp.Rawdata) > max || size > max {
+			resp.Rawdata = resp.Rawdata[:min(len(resp.Rawdata), max)]
+			resp.Truncated = true
+			return &LimitError{Kind: LimitHeader, Limit: max}
+		}
+	}
+	if max := obj.MaxResponseBytes; max > 0 && len(resp.Rawdata) > max {
+		resp.Rawdata = resp.Rawdata[:max]
+		resp.Truncated = true
+		return &LimitError{Kind: LimitResponse, Limit: max}
+	}
+	return nil
+}
+
+// headerSize returns the length of the status line and headers, without
+// the empty line ending them, or -1 when the empty line was not received.
+func headerSize(data []byte) int {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\n' {
+			continue
+		}
+		rest := data[i+1:]
+		if bytes.HasPrefix(rest, []byte("\r\n")) || bytes.HasPrefix(rest, []byte("\n")) {
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,144 @@
+package rawhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestHeaderSize(t *testing.T) {
+	tests := []struct {
+		data string
+		want int
+	}{
+		{"HTTP/1.1 200 OK\r\nA: b\r\n\r\nbody", 23},
+		{"HTTP/1.1 200 OK\nA: b\n\nbody", 21},
+		{"HTTP/1.1 200 OK\r\n\r\n", 17},
+		{"HTTP/1.1 200 OK\r\nA: b\r\n", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		if got := headerSize([]byte(tt.data)); got != tt.want {
+			t.Errorf("headerSize(%q) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestClient_Do_Limits(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		maxResp   int
+		maxHeader int
+		wantKind  LimitKind
+		wantRaw   string
+		wantErr   bool
+	}{
+		{
+			name:     "response over limit",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n0123456789",
+			maxResp:  40,
+			wantKind: LimitResponse,
+			wantRaw:  "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n0",
+			wantErr:  true,
+		},
+		{
+			name:     "response at limit",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			maxResp:  40,
+			wantRaw:  "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+		},
+		{
+			name:      "endless headers",
+			response:  "HTTP/1.1 200 OK\r\n" + strings.Repeat("X-Pad: aaaaaaaaaa\r\n", 100),
+			maxHeader: 64,
+			wantKind:  LimitHeader,
+			wantRaw:   ("HTTP/1.1 200 OK\r\n" + strings.Repeat("X-Pad: aaaaaaaaaa\r\n", 100))[:64],
+			wantErr:   true,
+		},
+		{
+			name:      "large body under header limit",
+			response:  "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("b", 100),
+			maxHeader: 64,
+			wantRaw:   "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("b", 100),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rawhttptest.NewServer(rawhttptest.Script{
+				rawhttptest.ExpectRequest(),
+				rawhttptest.Write(tt.response),
+			})
+			defer srv.Close()
+
+			client := NewDefaultClient()
+			client.MaxResponseBytes = tt.maxResp
+			client.MaxHeaderBytes = tt.maxHeader
+			defer client.Close()
+
+			req := &Request{
+				Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+				URL:     srv.URL + "/",
+			}
+			resp := &Response{}
+			err := client.Do(req, resp)
+
+			var lerr *LimitError
+			if tt.wantErr {
+				if !errors.As(err, &lerr) || lerr.Kind != tt.wantKind {
+					t.Fatalf("Do() error = %v, want %s limit", err, tt.wantKind)
+				}
+			} else if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if resp.Truncated != tt.wantErr {
+				t.Errorf("Truncated = %t, want %t", resp.Truncated, tt.wantErr)
+			}
+			if string(resp.Rawdata) != tt.wantRaw {
+				t.Errorf("Rawdata = %q, want %q", resp.Rawdata, tt.wantRaw)
+			}
+		})
+	}
+}
+
+func TestResponse_MaxDecodedBytes(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(bytes.Repeat([]byte{0}, 1<<20))
+	zw.Close()
+	raw := "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: " +
+		strconv.Itoa(zipped.Len()) + "\r\n\r\n" + zipped.String()
+
+	resp := &Response{Rawdata: []byte(raw), MaxDecodedBytes: 1024}
+	err := resp.ParseRawdata()
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Kind != LimitDecoded || lerr.Limit != 1024 {
+		t.Fatalf("ParseRawdata() error = %v, want decoded body limit", err)
+	}
+	if len(resp.Body()) != 1024 || !resp.Truncated {
+		t.Errorf("len(Body()) = %d, Truncated = %t", len(resp.Body()), resp.Truncated)
+	}
+	if resp.StatusCode() != 200 {
+		t.Errorf("StatusCode() = %d, want 200", resp.StatusCode())
+	}
+	if err := resp.ParseRawdata(); !errors.As(err, &lerr) {
+		t.Errorf("second ParseRawdata() error = %v, want LimitError", err)
+	}
+
+	resp = &Response{Rawdata: []byte(raw), MaxDecodedBytes: 1 << 20}
+	if err := resp.ParseRawdata(); err != nil || resp.Truncated {
+		t.Errorf("ParseRawdata() at limit error = %v, Truncated = %t", err, resp.Truncated)
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	err := &LimitError{Kind: LimitHeader, Limit: 8192}
+	if got, want := err.Error(), "header exceeds 8192 bytes"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
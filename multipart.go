@@ -0,0 +1,333 @@
+package rawhttp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/vodafon/vgutils"
+)
+
+// FilenameEncoding selects how FormPart writes the filename parameter.
+type FilenameEncoding int
+
+const (
+	// FilenameQuoted writes filename="name".
+	FilenameQuoted FilenameEncoding = iota
+	// FilenameUnquoted writes filename=name.
+	FilenameUnquoted
+	// FilenameRFC2231 writes filename*=UTF-8''percent-encoded-name.
+	FilenameRFC2231
+	// FilenameBoth writes the quoted form followed by the RFC 2231 form.
+	FilenameBoth
+)
+
+// FormPart is one part of a multipart/form-data body. Names and filenames
+// are written as is, without escaping, so they can carry quotes, CRLFs or
+// path traversal sequences.
+type FormPart struct {
+	Name     string
+	Filename string // no filename parameter when empty
+	// FilenameEncoding selects how Filename is written.
+	FilenameEncoding FilenameEncoding
+	// ExtraFilenames are written as additional filename="..." parameters
+	// after the first one.
+	ExtraFilenames []string
+	// ContentType sets the Content-Type header of the part when not empty.
+	ContentType string
+	// ContentTypeFirst writes Content-Type before Content-Disposition.
+	ContentTypeFirst bool
+	// Headers are raw header lines written after the generated ones.
+	Headers []string
+	Body    []byte
+}
+
+func (obj FormPart) disposition() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `Content-Disposition: form-data; name="%s"`, obj.Name)
+	if obj.Filename != "" {
+		switch obj.FilenameEncoding {
+		case FilenameUnquoted:
+			fmt.Fprintf(&sb, "; filename=%s", obj.Filename)
+		case FilenameRFC2231:
+			fmt.Fprintf(&sb, "; filename*=UTF-8''%s", rfc2231Escape(obj.Filename))
+		case FilenameBoth:
+			fmt.Fprintf(&sb, `; filename="%s"; filename*=UTF-8''%s`, obj.Filename, rfc2231Escape(obj.Filename))
+		default:
+			fmt.Fprintf(&sb, `; filename="%s"`, obj.Filename)
+		}
+	}
+	for _, name := range obj.ExtraFilenames {
+		fmt.Fprintf(&sb, `; filename="%s"`, name)
+	}
+	return sb.String()
+}
+
+func (obj FormPart) writeTo(buf *bytes.Buffer) {
+	var lines []string
+	if obj.ContentType != "" && obj.ContentTypeFirst {
+		lines = append(lines, "Content-Type: "+obj.ContentType)
+	}
+	lines = append(lines, obj.disposition())
+	if obj.ContentType != "" && !obj.ContentTypeFirst {
+		lines = append(lines, "Content-Type: "+obj.ContentType)
+	}
+	lines = append(lines, obj.Headers...)
+
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("\r\n")
+	buf.Write(obj.Body)
+}
+
+// rfc2231Escape percent-encodes every byte that is not an attr-char of
+// RFC 5987.
+func rfc2231Escape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) != -1 {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+// NewMultipartBoundary returns a random boundary.
+func NewMultipartBoundary() string {
+	return "----RawhttpBoundary" + vgutils.RandomHEXString(8)
+}
+
+// MultipartBody returns a multipart/form-data body with the given parts.
+func MultipartBody(boundary string, parts []FormPart) []byte {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		buf.WriteString("--" + boundary + "\r\n")
+		p.writeTo(&buf)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + boundary + "--\r\n")
+	return buf.Bytes()
+}
+
+// SetMultipartBody replaces the body of a parsed request with a
+// multipart/form-data body and sets the matching Content-Type and
+// Content-Length headers. A random boundary is used when boundary is empty.
+// The body is sent verbatim: the client neither expands variables nor
+// changes line endings in it.
+func (obj *Request) SetMultipartBody(boundary string, parts []FormPart) {
+	if boundary == "" {
+		boundary = NewMultipartBoundary()
+	}
+	obj.setFormBody("multipart/form-data; boundary="+boundary, MultipartBody(boundary, parts))
+}
+
+// SetURLEncodedBody replaces the body of a parsed request with the encoded
+// values and sets the matching Content-Type and Content-Length headers. The
+// body is sent verbatim, as with SetMultipartBody.
+func (obj *Request) SetURLEncodedBody(values url.Values) {
+	obj.setFormBody("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+func (obj *Request) setFormBody(contentType string, body []byte) {
+	obj.setRawBody(body)
+	obj.SetHeader("content-type", []byte("Content-Type"), []byte(contentType))
+	obj.SetHeader("content-length", []byte("Content-Length"), []byte(strconv.Itoa(len(body))))
+}
+
+// FormField is a decoded form field. Fields of urlencoded bodies only have
+// Name and Body.
+type FormField struct {
+	Name        string
+	Filename    string
+	ContentType string
+	Header      textproto.MIMEHeader
+	Body        []byte
+}
+
+// Form is a decoded multipart/form-data or urlencoded body.
+type Form struct {
+	Fields []FormField
+}
+
+// Value returns the body of the first field named name.
+func (obj *Form) Value(name string) string {
+	if f := obj.Field(name); f != nil {
+		return string(f.Body)
+	}
+	return ""
+}
+
+// Field returns the first field named name, or nil.
+func (obj *Form) Field(name string) *FormField {
+	for i := range obj.Fields {
+		if obj.Fields[i].Name == name {
+			return &obj.Fields[i]
+		}
+	}
+	return nil
+}
+
+var NotFormError = fmt.Errorf("Not a form body")
+
+// ParseForm decodes a multipart/form-data or
+// application/x-www-form-urlencoded body. Parts whose Content-Disposition
+// cannot be parsed, e.g. because of duplicate parameters, are returned
+// with an empty Name and their raw Header.
+func ParseForm(contentType string, body []byte) (*Form, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", NotFormError, err)
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		return parseURLEncodedForm(body)
+	case "multipart/form-data":
+		if params["boundary"] == "" {
+			return nil, fmt.Errorf("%w: missing boundary", NotFormError)
+		}
+		return parseMultipartForm(params["boundary"], body)
+	}
+	return nil, fmt.Errorf("%w: %s", NotFormError, mediaType)
+}
+
+func parseURLEncodedForm(body []byte) (*Form, error) {
+	form := &Form{}
+	for _, pair := range strings.Split(string(body), "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			return nil, err
+		}
+		form.Fields = append(form.Fields, FormField{Name: name, Body: []byte(value)})
+	}
+	return form, nil
+}
+
+func parseMultipartForm(boundary string, body []byte) (*Form, error) {
+	form := &Form{}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		field := FormField{
+			ContentType: part.Header.Get("Content-Type"),
+			Header:      part.Header,
+			Body:        data,
+		}
+		disposition := part.Header.Get("Content-Disposition")
+		_, params, err := mime.ParseMediaType(disposition)
+		if err != nil {
+			// e.g. a repeated filename, as FormPart.ExtraFilenames writes
+			params = parseDispositionParams(disposition)
+		}
+		field.Name = params["name"]
+		field.Filename = params["filename"]
+		form.Fields = append(form.Fields, field)
+	}
+}
+
+// parseDispositionParams parses the parameters of a Content-Disposition
+// value that mime.ParseMediaType rejects. The first occurrence of a
+// parameter wins and an RFC 2231 filename* replaces filename.
+func parseDispositionParams(v string) map[string]string {
+	params := make(map[string]string)
+	_, rest, _ := strings.Cut(v, ";")
+	for rest != "" {
+		var param string
+		param, rest = cutDispositionParam(rest)
+		key, value, ok := strings.Cut(param, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || key == "" {
+			continue
+		}
+		if _, seen := params[key]; !seen {
+			params[key] = unquoteParam(strings.TrimSpace(value))
+		}
+	}
+	if ext, ok := params["filename*"]; ok {
+		if _, encoded, ok := strings.Cut(ext, "''"); ok {
+			if name, err := url.PathUnescape(encoded); err == nil {
+				params["filename"] = name
+			}
+		}
+		delete(params, "filename*")
+	}
+	return params
+}
+
+// cutDispositionParam returns the parameter up to the next ';' outside a
+// quoted string, and the rest after it.
+func cutDispositionParam(s string) (string, string) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ';' && !quoted:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// unquoteParam removes the quotes and backslash escapes of a quoted
+// parameter value.
+func unquoteParam(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+	var sb strings.Builder
+	for i := 1; i < len(v)-1; i++ {
+		if v[i] == '\\' && i+1 < len(v)-1 {
+			i++
+		}
+		sb.WriteByte(v[i])
+	}
+	return sb.String()
+}
+
+// Form decodes the body of a parsed request according to its Content-Type
+// header, see ParseForm.
+func (obj *Request) Form() (*Form, error) {
+	return ParseForm(string(obj.headers["content-type"].Value), obj.body)
+}
+
+// Form decodes the response body according to its Content-Type header, see
+// ParseForm.
+func (obj *Response) Form() (*Form, error) {
+	if err := obj.ParseRawdata(); err != nil {
+		return nil, err
+	}
+	return ParseForm(obj.header.Get("Content-Type"), obj.body)
+}
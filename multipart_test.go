@@ -0,0 +1,207 @@
+package rawhttp
+
+import (
+	"errors"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestMultipartBody(t *testing.T) {
+	tests := []struct {
+		name string
+		part FormPart
+		want string
+	}{
+		{
+			name: "plain field",
+			part: FormPart{Name: "a", Body: []byte("1")},
+			want: "Content-Disposition: form-data; name=\"a\"\r\n\r\n1",
+		},
+		{
+			name: "quoted filename with content type",
+			part: FormPart{Name: "f", Filename: "x.php", ContentType: "image/png", Body: []byte("<?php")},
+			want: "Content-Disposition: form-data; name=\"f\"; filename=\"x.php\"\r\nContent-Type: image/png\r\n\r\n<?php",
+		},
+		{
+			name: "content type first",
+			part: FormPart{Name: "f", ContentType: "text/plain", ContentTypeFirst: true},
+			want: "Content-Type: text/plain\r\nContent-Disposition: form-data; name=\"f\"\r\n\r\n",
+		},
+		{
+			name: "unquoted filename",
+			part: FormPart{Name: "f", Filename: "a.txt", FilenameEncoding: FilenameUnquoted},
+			want: "Content-Disposition: form-data; name=\"f\"; filename=a.txt\r\n\r\n",
+		},
+		{
+			name: "rfc 2231 filename",
+			part: FormPart{Name: "f", Filename: "ü a.txt", FilenameEncoding: FilenameRFC2231},
+			want: "Content-Disposition: form-data; name=\"f\"; filename*=UTF-8''%C3%BC%20a.txt\r\n\r\n",
+		},
+		{
+			name: "both filename forms",
+			part: FormPart{Name: "f", Filename: "a b", FilenameEncoding: FilenameBoth},
+			want: "Content-Disposition: form-data; name=\"f\"; filename=\"a b\"; filename*=UTF-8''a%20b\r\n\r\n",
+		},
+		{
+			name: "duplicate filename and extra headers",
+			part: FormPart{Name: "f", Filename: "a.jpg", ExtraFilenames: []string{"a.php"}, Headers: []string{"X-A: 1"}},
+			want: "Content-Disposition: form-data; name=\"f\"; filename=\"a.jpg\"; filename=\"a.php\"\r\nX-A: 1\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(MultipartBody("B", []FormPart{tt.part}))
+			want := "--B\r\n" + tt.want + "\r\n--B--\r\n"
+			if got != want {
+				t.Errorf("MultipartBody() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRequest_SetMultipartBody(t *testing.T) {
+	req := &Request{Rawdata: []byte("POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	req.SetMultipartBody("", []FormPart{
+		{Name: "title", Body: []byte("hello")},
+		{Name: "file", Filename: "ü.txt", FilenameEncoding: FilenameRFC2231, ContentType: "text/plain", Body: []byte("data")},
+		{Name: "dup", Filename: "a.jpg", ExtraFilenames: []string{"a.php"}, Body: []byte("x")},
+	})
+
+	ct := string(req.headers["content-type"].Value)
+	if !strings.HasPrefix(ct, "multipart/form-data; boundary=----RawhttpBoundary") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if got, want := string(req.headers["content-length"].Value), len(req.body); got != strconv.Itoa(want) {
+		t.Errorf("Content-Length = %q, want %d", got, want)
+	}
+
+	form, err := req.Form()
+	if err != nil {
+		t.Fatalf("Form() error: %v", err)
+	}
+	if len(form.Fields) != 3 {
+		t.Fatalf("len(Fields) = %d, want 3", len(form.Fields))
+	}
+	if got := form.Value("title"); got != "hello" {
+		t.Errorf("title = %q, want hello", got)
+	}
+	file := form.Field("file")
+	if file == nil || file.Filename != "ü.txt" || file.ContentType != "text/plain" || string(file.Body) != "data" {
+		t.Errorf("file = %+v", file)
+	}
+	// duplicate parameters are parsed leniently, the first filename wins
+	if dup := form.Field("dup"); dup == nil || dup.Filename != "a.jpg" || string(dup.Body) != "x" {
+		t.Errorf("dup = %+v", dup)
+	}
+}
+
+func TestParseDispositionParams(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]string
+	}{
+		{
+			`form-data; name="a"; filename="a.jpg"; filename="a.php"`,
+			map[string]string{"name": "a", "filename": "a.jpg"},
+		},
+		{
+			`form-data; name="x;y"; filename="q\"uote.txt"; filename=b`,
+			map[string]string{"name": "x;y", "filename": `q"uote.txt`},
+		},
+		{
+			`form-data; NAME=a; filename="a"; filename*=UTF-8''%C3%BC.txt; filename="b"`,
+			map[string]string{"name": "a", "filename": "ü.txt"},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseDispositionParams(tt.value); !maps.Equal(got, tt.want) {
+			t.Errorf("parseDispositionParams(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestClient_Do_MultipartBodyVerbatim(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	req := &Request{
+		Rawdata: []byte("POST /upload HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/upload",
+	}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+	req.SetMultipartBody("b", []FormPart{{Name: "f", Filename: "a.txt", Body: []byte("line1\nline2 ||HOST||")}})
+	body := string(req.body)
+
+	if err := client.Do(req, &Response{}); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	want := "POST /upload HTTP/1.1\r\nHost: 127.0.0.1\r\nContent-Type: multipart/form-data; boundary=b\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	if got := string(srv.Conn(0).Received()); got != want {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+	if !strings.Contains(body, "line1\nline2 ||HOST||") {
+		t.Errorf("body = %q, want the part unchanged", body)
+	}
+}
+
+func TestRequest_SetURLEncodedBody(t *testing.T) {
+	req := &Request{Rawdata: []byte("POST / HTTP/1.1\r\nHost: example.com\r\n\r\n")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	req.SetURLEncodedBody(url.Values{"a": {"1 2"}, "b": {"&"}})
+
+	want := "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 11\r\n\r\na=1+2&b=%26"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+
+	form, err := req.Form()
+	if err != nil {
+		t.Fatalf("Form() error: %v", err)
+	}
+	if form.Value("a") != "1 2" || form.Value("b") != "&" {
+		t.Errorf("Fields = %+v", form.Fields)
+	}
+}
+
+func TestResponse_Form(t *testing.T) {
+	body := string(MultipartBody("xyz", []FormPart{{Name: "k", Body: []byte("v")}}))
+	resp := &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Type: multipart/form-data; boundary=xyz\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body)}
+
+	form, err := resp.Form()
+	if err != nil {
+		t.Fatalf("Form() error: %v", err)
+	}
+	if got := form.Value("k"); got != "v" {
+		t.Errorf("k = %q, want v", got)
+	}
+
+	resp = &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 0\r\n\r\n")}
+	if _, err := resp.Form(); !errors.Is(err, NotFormError) {
+		t.Errorf("Form() error = %v, want NotFormError", err)
+	}
+}
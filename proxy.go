@@ -2,11 +2,12 @@ package rawhttp
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
-	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -17,20 +18,42 @@ type httpDialer struct {
 }
 
 func (obj httpDialer) Dial(network, addr string) (net.Conn, error) {
-	return net.DialTimeout(network, addr, obj.Timeout)
+	conn, err := net.DialTimeout(network, addr, obj.Timeout)
+	if err != nil {
+		return nil, netError(PhaseDial, addr, err)
+	}
+	return conn, nil
 }
 
 type httpsDialer struct {
 	Timeout time.Duration
 }
 
-func (obj httpsDialer) Dial(network, addr string) (c net.Conn, err error) {
-	dialer := &net.Dialer{
-		Timeout: obj.Timeout,
+// Dial connects and performs the TLS handshake, both within Timeout, so
+// that failures of either step are told apart.
+func (obj httpsDialer) Dial(network, addr string) (net.Conn, error) {
+	var deadline time.Time
+	if obj.Timeout != 0 {
+		deadline = time.Now().Add(obj.Timeout)
+	}
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, netError(PhaseDial, addr, err)
 	}
-	return tls.DialWithDialer(dialer, network, addr, &tls.Config{
+
+	host, _, _ := net.SplitHostPort(addr)
+	tlsConn := tls.Client(conn, &tls.Config{
 		InsecureSkipVerify: true,
+		ServerName:         host,
 	})
+	conn.SetDeadline(deadline)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, netError(PhaseTLS, addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
 }
 
 // bufferedConn wraps a net.Conn with a buffered reader to preserve any
@@ -96,25 +119,43 @@ func (s *httpProxy) Dial(network, addr string) (net.Conn, error) {
 	err = req.Write(c)
 	if err != nil {
 		c.Close()
-		return nil, err
+		return nil, netError(PhaseProxy, s.host, err)
 	}
 
 	br := bufio.NewReader(c)
 	resp, err := http.ReadResponse(br, req)
 	if err != nil {
 		c.Close()
-		return nil, err
+		return nil, netError(PhaseProxy, s.host, err)
 	}
 	resp.Body.Close()
 	if resp.StatusCode != 200 {
 		c.Close()
-		err = fmt.Errorf("Connect server using proxy error, StatusCode [%d]", resp.StatusCode)
-		return nil, err
+		return nil, &NetError{
+			Kind:       NetProxyRejected,
+			Phase:      PhaseProxy,
+			Addr:       s.host,
+			StatusCode: resp.StatusCode,
+		}
 	}
 
 	return &bufferedConn{Conn: c, reader: br}, nil
 }
 
+// statusCodeOf returns the status code of a raw response, zero when the
+// status line cannot be parsed.
+func statusCodeOf(data []byte) int {
+	fields := bytes.Fields(bytes.SplitN(data, []byte("\n"), 2)[0])
+	if len(fields) < 2 || !bytes.HasPrefix(fields[0], []byte("HTTP/")) {
+		return 0
+	}
+	code, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
 func ProxyFromURL(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
 	return proxy.FromURL(u, forward)
 }
@@ -0,0 +1,162 @@
+package rawhttptest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type stepKind int
+
+const (
+	stepExpect stepKind = iota
+	stepExpectRequest
+	stepRead
+	stepWrite
+	stepSleep
+	stepClose
+	stepReset
+)
+
+// Step is a single action in a connection Script.
+type Step struct {
+	kind  stepKind
+	data  []byte
+	n     int
+	delay time.Duration
+}
+
+// Script is the sequence of steps the server runs for one connection.
+// After the last step the connection is kept open and drained until the
+// peer closes it or the server shuts down; end a script with Close or Reset
+// to hang up instead.
+type Script []Step
+
+// Expect reads from the connection until the unread data contains pattern
+// and consumes everything up to and including it.
+func Expect(pattern string) Step {
+	return Step{kind: stepExpect, data: []byte(pattern)}
+}
+
+// ExpectRequest reads a request head terminated by an empty line and, when
+// a Content-Length header is present, that many body bytes.
+func ExpectRequest() Step {
+	return Step{kind: stepExpectRequest}
+}
+
+// Read consumes exactly n bytes from the connection.
+func Read(n int) Step {
+	return Step{kind: stepRead, n: n}
+}
+
+// Write sends data to the peer as a single write.
+func Write(data string) Step {
+	return Step{kind: stepWrite, data: []byte(data)}
+}
+
+// WriteSlow sends data one byte at a time, pausing delay between bytes.
+func WriteSlow(data string, delay time.Duration) Step {
+	return Step{kind: stepWrite, data: []byte(data), delay: delay}
+}
+
+// Sleep pauses the script for d.
+func Sleep(d time.Duration) Step {
+	return Step{kind: stepSleep, delay: d}
+}
+
+// Close closes the connection gracefully.
+func Close() Step {
+	return Step{kind: stepClose}
+}
+
+// Reset aborts the connection so the peer sees a TCP reset instead of a
+// clean EOF. On TLS listeners it behaves like Close.
+func Reset() Step {
+	return Step{kind: stepReset}
+}
+
+func (obj Step) String() string {
+	switch obj.kind {
+	case stepExpect:
+		return fmt.Sprintf("Expect(%q)", obj.data)
+	case stepExpectRequest:
+		return "ExpectRequest()"
+	case stepRead:
+		return fmt.Sprintf("Read(%d)", obj.n)
+	case stepWrite:
+		return fmt.Sprintf("Write(%q)", obj.data)
+	case stepSleep:
+		return fmt.Sprintf("Sleep(%s)", obj.delay)
+	case stepClose:
+		return "Close()"
+	case stepReset:
+		return "Reset()"
+	}
+	return "Step(?)"
+}
+
+// errHangup signals that the script closed the connection on purpose.
+var errHangup = fmt.Errorf("hangup")
+
+func (obj Step) run(c *Conn) error {
+	switch obj.kind {
+	case stepExpect:
+		_, err := c.readUntil(obj.data)
+		return err
+	case stepExpectRequest:
+		head, err := c.readUntil([]byte("\r\n\r\n"))
+		if err != nil {
+			return err
+		}
+		n := contentLength(head)
+		if n > 0 {
+			_, err = c.readN(n)
+		}
+		return err
+	case stepRead:
+		_, err := c.readN(obj.n)
+		return err
+	case stepWrite:
+		if obj.delay <= 0 {
+			_, err := c.conn.Write(obj.data)
+			return err
+		}
+		for i := range obj.data {
+			if _, err := c.conn.Write(obj.data[i : i+1]); err != nil {
+				return err
+			}
+			time.Sleep(obj.delay)
+		}
+		return nil
+	case stepSleep:
+		time.Sleep(obj.delay)
+		return nil
+	case stepClose:
+		c.conn.Close()
+		return errHangup
+	case stepReset:
+		if tc, ok := c.conn.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+		c.conn.Close()
+		return errHangup
+	}
+	return fmt.Errorf("unknown step %d", obj.kind)
+}
+
+func contentLength(head []byte) int {
+	for _, line := range bytes.Split(head, []byte("\r\n")) {
+		k, v, ok := strings.Cut(string(line), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "content-length") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package rawhttptest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestContentLength(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want int
+	}{
+		{
+			name: "present",
+			head: "POST / HTTP/1.1\r\nContent-Length: 12\r\n\r\n",
+			want: 12,
+		},
+		{
+			name: "case insensitive with spaces",
+			head: "POST / HTTP/1.1\r\ncontent-length :  7 \r\n\r\n",
+			want: 7,
+		},
+		{
+			name: "missing",
+			head: "GET / HTTP/1.1\r\nHost: x\r\n\r\n",
+			want: 0,
+		},
+		{
+			name: "invalid",
+			head: "POST / HTTP/1.1\r\nContent-Length: abc\r\n\r\n",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentLength([]byte(tt.head)); got != tt.want {
+				t.Errorf("contentLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStep_ReadAndWriteSlow(t *testing.T) {
+	srv := NewServer(Script{
+		Read(4),
+		WriteSlow("abc", time.Millisecond),
+		Close(),
+	})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("ping"))
+	got, _ := io.ReadAll(conn)
+	if string(got) != "abc" {
+		t.Errorf("response = %q, want %q", got, "abc")
+	}
+}
+
+func TestStep_Reset(t *testing.T) {
+	srv := NewServer(Script{Expect("x"), Reset()})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("x"))
+	srv.Conn(0).Wait()
+
+	_, err = io.ReadAll(conn)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("ReadAll() error = %v, want connection reset", err)
+	}
+}
+
+func TestStep_String(t *testing.T) {
+	tests := []struct {
+		step Step
+		want string
+	}{
+		{Expect("a"), `Expect("a")`},
+		{ExpectRequest(), "ExpectRequest()"},
+		{Read(3), "Read(3)"},
+		{Write("b"), `Write("b")`},
+		{Sleep(time.Second), "Sleep(1s)"},
+		{Close(), "Close()"},
+		{Reset(), "Reset()"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.step.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
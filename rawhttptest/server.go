@@ -0,0 +1,354 @@
+// Package rawhttptest provides TCP and TLS servers whose behaviour on each
+// connection is scripted step by step. It is meant for exercising raw HTTP
+// clients against malformed framing, split or delayed responses, early
+// closes and keep-alive surprises.
+package rawhttptest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultReadTimeout = 5 * time.Second
+)
+
+// Server is a scripted test server listening on the loopback interface.
+type Server struct {
+	// Addr is the "host:port" the server listens on.
+	Addr string
+	// URL is the base URL of the server, "http://..." or "https://...".
+	URL string
+
+	// ReadTimeout bounds every read step. Default: DefaultReadTimeout.
+	// It must be set before Start or StartTLS.
+	ReadTimeout time.Duration
+
+	listener net.Listener
+	scripts  []Script
+
+	mu     sync.Mutex
+	conns  []*Conn
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Conn records what a single accepted connection received.
+type Conn struct {
+	conn        net.Conn
+	readTimeout time.Duration
+
+	mu       sync.Mutex
+	received []byte
+	pending  []byte
+	err      error
+	done     chan struct{}
+}
+
+// NewServer starts a TCP server running scripts[i] on the i-th accepted
+// connection. Connections beyond len(scripts) reuse the last script.
+func NewServer(scripts ...Script) *Server {
+	s := NewUnstartedServer(scripts...)
+	s.Start()
+	return s
+}
+
+// NewTLSServer starts a TLS server with a self-signed certificate.
+func NewTLSServer(scripts ...Script) *Server {
+	s := NewUnstartedServer(scripts...)
+	s.StartTLS()
+	return s
+}
+
+// NewUnstartedServer returns a server that is not listening yet, so its
+// fields can be adjusted before calling Start or StartTLS.
+func NewUnstartedServer(scripts ...Script) *Server {
+	return &Server{
+		ReadTimeout: DefaultReadTimeout,
+		scripts:     scripts,
+	}
+}
+
+// Start begins accepting plain TCP connections.
+func (obj *Server) Start() {
+	obj.start(newLocalListener(), "http")
+}
+
+// StartTLS begins accepting TLS connections.
+func (obj *Server) StartTLS() {
+	l := tls.NewListener(newLocalListener(), &tls.Config{
+		Certificates: []tls.Certificate{localhostCert()},
+	})
+	obj.start(l, "https")
+}
+
+func (obj *Server) start(l net.Listener, scheme string) {
+	if obj.listener != nil {
+		panic("rawhttptest: server already started")
+	}
+	obj.listener = l
+	obj.Addr = l.Addr().String()
+	obj.URL = scheme + "://" + obj.Addr
+	obj.wg.Add(1)
+	go obj.serve()
+}
+
+func newLocalListener() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("rawhttptest: failed to listen: %v", err))
+	}
+	return l
+}
+
+func (obj *Server) serve() {
+	defer obj.wg.Done()
+	for {
+		nc, err := obj.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		obj.mu.Lock()
+		if obj.closed {
+			obj.mu.Unlock()
+			nc.Close()
+			return
+		}
+		c := &Conn{
+			conn:        nc,
+			readTimeout: obj.ReadTimeout,
+			done:        make(chan struct{}),
+		}
+		script := obj.scriptFor(len(obj.conns))
+		obj.conns = append(obj.conns, c)
+		obj.wg.Add(1)
+		obj.mu.Unlock()
+
+		go func() {
+			defer obj.wg.Done()
+			c.run(script)
+		}()
+	}
+}
+
+func (obj *Server) scriptFor(i int) Script {
+	if len(obj.scripts) == 0 {
+		return nil
+	}
+	if i >= len(obj.scripts) {
+		i = len(obj.scripts) - 1
+	}
+	return obj.scripts[i]
+}
+
+// Conns returns the connections accepted so far, in accept order.
+func (obj *Server) Conns() []*Conn {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return append([]*Conn(nil), obj.conns...)
+}
+
+// Conn returns the i-th accepted connection, waiting up to ReadTimeout for
+// it to arrive. It returns nil if the connection was never accepted.
+func (obj *Server) Conn(i int) *Conn {
+	deadline := time.Now().Add(obj.ReadTimeout)
+	for {
+		obj.mu.Lock()
+		if i < len(obj.conns) {
+			c := obj.conns[i]
+			obj.mu.Unlock()
+			return c
+		}
+		obj.mu.Unlock()
+		if time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Close stops the listener, closes all connections and waits for their
+// scripts to finish.
+func (obj *Server) Close() {
+	obj.mu.Lock()
+	obj.closed = true
+	conns := append([]*Conn(nil), obj.conns...)
+	obj.mu.Unlock()
+
+	if obj.listener != nil {
+		obj.listener.Close()
+	}
+	for _, c := range conns {
+		c.conn.Close()
+	}
+	obj.wg.Wait()
+}
+
+func (obj *Conn) run(script Script) {
+	defer close(obj.done)
+	defer obj.conn.Close()
+
+	for i, step := range script {
+		if err := step.run(obj); err != nil {
+			if err != errHangup {
+				obj.setErr(fmt.Errorf("step %d %s: %w", i, step, err))
+			}
+			return
+		}
+	}
+
+	// Script finished: keep recording until the peer goes away.
+	buf := make([]byte, 4096)
+	for {
+		obj.conn.SetReadDeadline(time.Time{})
+		n, err := obj.conn.Read(buf)
+		if n > 0 {
+			obj.record(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Received returns a copy of every byte the connection has read so far.
+func (obj *Conn) Received() []byte {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return append([]byte(nil), obj.received...)
+}
+
+// Wait blocks until the connection is closed and returns the first script
+// error, if any.
+func (obj *Conn) Wait() error {
+	<-obj.done
+	return obj.Err()
+}
+
+// Done returns a channel that is closed when the connection has finished.
+func (obj *Conn) Done() <-chan struct{} {
+	return obj.done
+}
+
+// Err returns the script error recorded so far, if any.
+func (obj *Conn) Err() error {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return obj.err
+}
+
+func (obj *Conn) setErr(err error) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	if obj.err == nil {
+		obj.err = err
+	}
+}
+
+func (obj *Conn) record(b []byte) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	obj.received = append(obj.received, b...)
+	obj.pending = append(obj.pending, b...)
+}
+
+// fill reads once from the network into the pending buffer.
+func (obj *Conn) fill(buf []byte) error {
+	obj.conn.SetReadDeadline(time.Now().Add(obj.readTimeout))
+	n, err := obj.conn.Read(buf)
+	if n > 0 {
+		obj.record(buf[:n])
+		return nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return err
+}
+
+// consume removes and returns the first n pending bytes.
+func (obj *Conn) consume(n int) []byte {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	out := append([]byte(nil), obj.pending[:n]...)
+	obj.pending = obj.pending[n:]
+	return out
+}
+
+func (obj *Conn) pendingIndex(pattern []byte) int {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return bytes.Index(obj.pending, pattern)
+}
+
+func (obj *Conn) pendingLen() int {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	return len(obj.pending)
+}
+
+func (obj *Conn) readUntil(pattern []byte) ([]byte, error) {
+	buf := make([]byte, 4096)
+	for {
+		if idx := obj.pendingIndex(pattern); idx != -1 {
+			return obj.consume(idx + len(pattern)), nil
+		}
+		if err := obj.fill(buf); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (obj *Conn) readN(n int) ([]byte, error) {
+	buf := make([]byte, 4096)
+	for obj.pendingLen() < n {
+		if err := obj.fill(buf); err != nil {
+			return nil, err
+		}
+	}
+	return obj.consume(n), nil
+}
+
+var (
+	certOnce sync.Once
+	cert     tls.Certificate
+)
+
+// localhostCert returns a self-signed certificate for 127.0.0.1 and
+// localhost, generated once per process.
+func localhostCert() tls.Certificate {
+	certOnce.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(fmt.Sprintf("rawhttptest: generate key: %v", err))
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{Organization: []string{"rawhttptest"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			panic(fmt.Sprintf("rawhttptest: create certificate: %v", err))
+		}
+		cert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	})
+	return cert
+}
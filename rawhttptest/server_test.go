@@ -0,0 +1,143 @@
+package rawhttptest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_ScriptedResponse(t *testing.T) {
+	srv := NewServer(Script{
+		ExpectRequest(),
+		Write("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"),
+		Close(),
+	})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	req := "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 4\r\n\r\nbody"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll() error: %v", err)
+	}
+	if string(got) != "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok" {
+		t.Errorf("response = %q", got)
+	}
+
+	c := srv.Conn(0)
+	if err := c.Wait(); err != nil {
+		t.Errorf("Wait() error: %v", err)
+	}
+	if string(c.Received()) != req {
+		t.Errorf("Received() = %q, want %q", c.Received(), req)
+	}
+}
+
+func TestServer_ScriptsPerConnection(t *testing.T) {
+	srv := NewServer(
+		Script{Expect("\r\n\r\n"), Write("first"), Close()},
+		Script{Expect("\r\n\r\n"), Write("second"), Close()},
+	)
+	defer srv.Close()
+
+	for _, want := range []string{"first", "second", "second"} {
+		conn, err := net.Dial("tcp", srv.Addr)
+		if err != nil {
+			t.Fatalf("Dial() error: %v", err)
+		}
+		conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		got, _ := io.ReadAll(conn)
+		conn.Close()
+		if string(got) != want {
+			t.Errorf("response = %q, want %q", got, want)
+		}
+	}
+
+	if n := len(srv.Conns()); n != 3 {
+		t.Errorf("len(Conns()) = %d, want 3", n)
+	}
+}
+
+func TestServer_KeepsConnectionOpenAfterScript(t *testing.T) {
+	srv := NewServer(Script{Expect("\r\n\r\n"), Write("one")})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	conn.Write([]byte("GET /1 HTTP/1.1\r\n\r\n"))
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("ReadFull() error: %v", err)
+	}
+
+	conn.Write([]byte("GET /2 HTTP/1.1\r\n\r\n"))
+	conn.Close()
+
+	c := srv.Conn(0)
+	c.Wait()
+	want := "GET /1 HTTP/1.1\r\n\r\nGET /2 HTTP/1.1\r\n\r\n"
+	if string(c.Received()) != want {
+		t.Errorf("Received() = %q, want %q", c.Received(), want)
+	}
+}
+
+func TestServer_ReadTimeout(t *testing.T) {
+	srv := NewUnstartedServer(Script{Expect("never")})
+	srv.ReadTimeout = 20 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := srv.Conn(0).Wait(); err == nil {
+		t.Error("Wait() expected timeout error, got nil")
+	}
+}
+
+func TestTLSServer(t *testing.T) {
+	srv := NewTLSServer(Script{
+		Expect("\r\n\r\n"),
+		Write("HTTP/1.1 204 No Content\r\n\r\n"),
+		Close(),
+	})
+	defer srv.Close()
+
+	if !strings.HasPrefix(srv.URL, "https://") {
+		t.Errorf("URL = %q, want https scheme", srv.URL)
+	}
+
+	conn, err := tls.Dial("tcp", srv.Addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("tls.Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	if line != "HTTP/1.1 204 No Content\r\n" {
+		t.Errorf("status line = %q", line)
+	}
+}
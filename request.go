@@ -24,11 +24,37 @@ type Request struct {
 	rawHeaders []byte
 	body       []byte
 	headers    map[string]HeaderLine
+
+	// rawBody is set by the body builders: the body is sent as is, without
+	// line ending normalisation, variables or length markers
+	rawBody bool
+
+	// line terminators of the request line and of the empty line ending
+	// the headers, "\r\n" when empty
+	httpLineEOL []byte
+	headerEnd   []byte
+
+	variables       *Variables
+	clientVariables *Variables
+	prepareErr      error
+
+	cacheBusters []CacheBuster
+	bodySource   *BodySource
 }
 
 type HeaderLine struct {
 	Key, Value []byte
 	Pos        int
+	// EOL is the line terminator, "\r\n" when empty.
+	EOL []byte
+	// Raw is the line as parsed, including folded continuation lines.
+	// Bytes writes it instead of Key and Value until the header is changed
+	// with SetHeader.
+	Raw []byte
+	// Malformed is set when the line is not a valid "name: value" field:
+	// no colon, an empty name or a name with invalid characters such as a
+	// space before the colon.
+	Malformed bool
 }
 
 func (obj *Request) SetRawdata(rd []byte) error {
@@ -39,15 +65,94 @@ func (obj *Request) SetRawdata(rd []byte) error {
 
 func (obj *Request) SetMethod(method []byte) {
 	obj.method = method
+	obj.httpLine = nil
+}
+
+// SetPath replaces the request target.
+func (obj *Request) SetPath(path []byte) {
+	obj.path = path
+	obj.httpLine = nil
+}
+
+// SetVersion replaces the protocol version. An empty version gives an
+// HTTP/0.9 request line, "GET /path".
+func (obj *Request) SetVersion(version []byte) {
+	obj.version = version
+	obj.httpLine = nil
+}
+
+// SetRequestLine stores a request line that is written verbatim by Bytes.
+// The method, target and version are derived from it, see ParseRawdata.
+func (obj *Request) SetRequestLine(line []byte) {
+	obj.httpLine = line
+	obj.method, obj.path, obj.version = parseRequestLine(line)
+}
+
+// RequestLine returns the request line written by Bytes, without its
+// terminator.
+func (obj *Request) RequestLine() []byte {
+	if obj.httpLine != nil {
+		return obj.httpLine
+	}
+	var buf bytes.Buffer
+	buf.Write(obj.method)
+	buf.Write([]byte(" "))
+	buf.Write(obj.path)
+	if len(obj.version) > 0 {
+		buf.Write([]byte(" "))
+		buf.Write(obj.version)
+	}
+	return buf.Bytes()
+}
+
+// TargetForm is the form of a request target, RFC 9112 section 3.2.
+type TargetForm int
+
+const (
+	OriginForm    TargetForm = iota // /path?query
+	AbsoluteForm                    // http://host/path
+	AuthorityForm                   // host:port
+	AsteriskForm                    // *
+	OtherForm                       // anything else
+)
+
+// TargetForm returns the form of the request target.
+func (obj *Request) TargetForm() TargetForm {
+	switch {
+	case string(obj.path) == "*":
+		return AsteriskForm
+	case bytes.HasPrefix(obj.path, []byte("/")):
+		return OriginForm
+	case bytes.Contains(obj.path, []byte("://")):
+		return AbsoluteForm
+	case bytes.EqualFold(obj.method, []byte("CONNECT")) ||
+		bytes.Contains(obj.path, []byte(":")) && !bytes.ContainsAny(obj.path, "/?#"):
+		return AuthorityForm
+	}
+	return OtherForm
 }
 
 func (obj *Request) SetBody(body []byte) {
 	obj.body = body
+	obj.rawBody = false
+}
+
+// setRawBody replaces the body with one PrepareRequest and
+// PrepareRequestVariables leave unchanged.
+func (obj *Request) setRawBody(body []byte) {
+	obj.body = body
+	obj.rawBody = true
+}
+
+// SetVariables attaches a template variable registry to the request. Its
+// variables take precedence over the client's registry and the built-ins.
+func (obj *Request) SetVariables(v *Variables) {
+	obj.variables = v
 }
 
 func (obj *Request) CacheBusterParam() {
 	param := vgutils.RandomHEXString(4)
-	obj.AddQueryParams([]byte(fmt.Sprintf("%s=%s", param, param)))
+	obj.AddCacheBuster(CacheBuster{Strategy: CacheBusterQuery, Name: param, Value: param})
 }
 
 func (obj *Request) ParsedPath() []byte {
@@ -68,103 +173,265 @@ func (obj *Request) AddQueryParams(params []byte) {
 		buf.Write(bytes.Join(fragmentPieces[1:], []byte("#")))
 	}
 	obj.path = buf.Bytes()
+	obj.httpLine = nil
 }
 
+// ParseRawdata splits Rawdata into the request line, headers and body.
+// The request line is kept verbatim and split best-effort into method,
+// target and version: "GET /" is an HTTP/0.9 request without version and
+// with more than three words the target spans all middle words. Lines may
+// end with "\r\n" or a bare "\n"; each header keeps its own
+// terminator so Bytes reproduces mixed line endings. A CR that is not
+// followed by LF is part of the line. The headers end at the first empty
+// line, "\n\n" as well as "\r\n\r\n"; Rawdata is never rewritten.
 func (obj *Request) ParseRawdata() error {
 	if obj.parsed {
 		return nil
 	}
-	if !bytes.Contains(obj.Rawdata, []byte("\r\n")) {
-		obj.Rawdata = prepareBytes(obj.Rawdata, &Request{})
-	}
 
-	pieces := bytes.Split(obj.Rawdata, []byte("\r\n\r\n"))
-	headers := bytes.Split(pieces[0], []byte("\r\n"))
-	if len(pieces) > 1 {
-		obj.body = bytes.Join(pieces[1:], []byte("\r\n\r\n"))
-	}
-	obj.httpLine = headers[0]
-	hlinePieces := trimSpaces(bytes.Split(obj.httpLine, []byte(" ")))
-	if len(hlinePieces) != 3 {
+	line, eol, rest := splitLine(obj.Rawdata)
+	obj.SetRequestLine(line)
+	obj.httpLineEOL = eol
+	if len(obj.method) == 0 {
 		return fmt.Errorf("invalid HTTP line: %q", obj.httpLine)
 	}
-	obj.method = hlinePieces[0]
-	obj.path = hlinePieces[1]
-	obj.version = hlinePieces[2]
 
-	obj.rawHeaders = bytes.Join(headers[1:], []byte("\r\n"))
 	obj.headers = make(map[string]HeaderLine)
-
-	for i, line := range headers[1:] {
-		linePieces := bytes.Split(line, []byte(":"))
-		k := linePieces[0]
-		v := []byte{}
-		if len(linePieces) > 1 {
-			v = bytes.TrimSpace(bytes.Join(linePieces[1:], []byte(":")))
+	obj.headerEnd = nil
+	obj.body = nil
+	obj.rawBody = false
+	headerStart := rest
+	var last string
+	for len(rest) > 0 {
+		line, eol, next := splitLine(rest)
+		if len(line) == 0 {
+			obj.rawHeaders = headerStart[:len(headerStart)-len(rest)]
+			obj.headerEnd = eol
+			obj.body = next
+			break
 		}
+		rest = next
+
+		// obs-fold: a line starting with whitespace continues the previous one
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			hl := obj.headers[last]
+			raw := append(append(append([]byte(nil), hl.Raw...), lineEnd(hl.EOL)...), line...)
+			hl.Key, hl.Value, hl.Malformed = parseHeaderLine(raw)
+			hl.Raw = raw
+			hl.EOL = eol
+			obj.headers[last] = hl
+			continue
+		}
+
+		k, v, malformed := parseHeaderLine(line)
+		pos := len(obj.headers)
 		key := strings.ToLower(string(k))
 		_, ok := obj.headers[key]
 		if ok {
-			key = fmt.Sprintf("%s_%d", key, i)
+			key = fmt.Sprintf("%s_%d", key, pos)
 		}
 		obj.headers[key] = HeaderLine{
-			Pos:   i,
-			Key:   k,
-			Value: v,
+			Pos:       pos,
+			Key:       k,
+			Value:     v,
+			EOL:       eol,
+			Raw:       line,
+			Malformed: malformed,
 		}
+		last = key
+	}
+	if obj.headerEnd == nil {
+		obj.rawHeaders = headerStart
 	}
 	obj.parsed = true
 	return nil
 }
 
+// parseRequestLine splits a request line into words separated by spaces
+// or tabs. The first word is the method and, with three or more words, the
+// last one is the version.
+func parseRequestLine(line []byte) (method, target, version []byte) {
+	var spans [][2]int
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		spans = append(spans, [2]int{start, i})
+	}
+
+	switch n := len(spans); {
+	case n == 0:
+		return nil, nil, nil
+	case n == 1:
+		return line[spans[0][0]:spans[0][1]], nil, nil
+	case n == 2:
+		return line[spans[0][0]:spans[0][1]], line[spans[1][0]:spans[1][1]], nil
+	default:
+		return line[spans[0][0]:spans[0][1]], line[spans[1][0]:spans[n-2][1]], line[spans[n-1][0]:spans[n-1][1]]
+	}
+}
+
+// splitLine cuts the first line of data. eol is "\r\n", "\n", or empty
+// for a last line without terminator.
+func splitLine(data []byte) (line, eol, rest []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i == -1 {
+		return data, nil, nil
+	}
+	if i > 0 && data[i-1] == '\r' {
+		return data[:i-1], data[i-1 : i+1], data[i+1:]
+	}
+	return data[:i], data[i : i+1], data[i+1:]
+}
+
+// parseHeaderLine splits a header line at the first colon. Folded
+// continuation lines are joined with a single space.
+func parseHeaderLine(raw []byte) (key, value []byte, malformed bool) {
+	var folded [][]byte
+	for len(raw) > 0 {
+		line, _, rest := splitLine(raw)
+		folded = append(folded, line)
+		raw = rest
+	}
+	line := folded[0]
+
+	idx := bytes.IndexByte(line, ':')
+	if idx == -1 {
+		return line, []byte{}, true
+	}
+	key = line[:idx]
+	parts := [][]byte{bytes.Trim(line[idx+1:], " \t")}
+	for _, f := range folded[1:] {
+		parts = append(parts, bytes.Trim(f, " \t"))
+	}
+	value = bytes.Join(parts, []byte(" "))
+	return key, value, len(key) == 0 || !isToken(key)
+}
+
+// isToken reports whether b only holds tchar bytes of RFC 9110.
+func isToken(b []byte) bool {
+	for _, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1) {
+			return false
+		}
+	}
+	return true
+}
+
+// lineEnd returns eol, or "\r\n" when it is empty.
+func lineEnd(eol []byte) []byte {
+	if len(eol) == 0 {
+		return []byte("\r\n")
+	}
+	return eol
+}
+
 func (obj *Request) SetHeader(key string, name, value []byte) {
+	if obj.headers == nil {
+		obj.headers = make(map[string]HeaderLine)
+	}
 	hl, ok := obj.headers[key]
 	if !ok {
 		hl.Pos = len(obj.headers)
 	}
 	hl.Key = name
 	hl.Value = value
+	hl.Raw = nil
+	hl.Malformed = false
 	obj.headers[key] = hl
 }
 
+// SetHeaderLine stores a header line that is written verbatim by Bytes,
+// e.g. one without a colon or with folded continuation lines. Key and
+// Value are derived from raw.
+func (obj *Request) SetHeaderLine(key string, raw []byte) {
+	if obj.headers == nil {
+		obj.headers = make(map[string]HeaderLine)
+	}
+	hl, ok := obj.headers[key]
+	if !ok {
+		hl.Pos = len(obj.headers)
+	}
+	hl.Key, hl.Value, hl.Malformed = parseHeaderLine(raw)
+	hl.Raw = raw
+	obj.headers[key] = hl
+}
+
+// DelHeader removes the header stored under key. The positions of the
+// following headers are shifted so that their order is kept.
+func (obj *Request) DelHeader(key string) {
+	hl, ok := obj.headers[key]
+	if !ok {
+		return
+	}
+	delete(obj.headers, key)
+	for k, v := range obj.headers {
+		if v.Pos > hl.Pos {
+			v.Pos--
+			obj.headers[k] = v
+		}
+	}
+}
+
+// headerKeys returns the map keys of every header named name, including
+// duplicates stored as "name_N".
+func (obj *Request) headerKeys(name string) []string {
+	var keys []string
+	for k := range obj.headers {
+		if k == name || strings.HasPrefix(k, name+"_") && isDigits(k[len(name)+1:]) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func (obj *Request) Bytes() []byte {
 	headerSlice := make([][]byte, len(obj.headers))
 
 	for _, v := range obj.headers {
 		var hbuf bytes.Buffer
-		hbuf.Write(v.Key)
-		hbuf.Write([]byte(": "))
-		hbuf.Write(v.Value)
+		if v.Raw != nil {
+			hbuf.Write(v.Raw)
+		} else {
+			hbuf.Write(v.Key)
+			hbuf.Write([]byte(": "))
+			hbuf.Write(v.Value)
+		}
+		hbuf.Write(lineEnd(v.EOL))
 		headerSlice[v.Pos] = hbuf.Bytes()
 	}
-	headers := bytes.Join(headerSlice, []byte("\r\n"))
 
 	var buf bytes.Buffer
-	buf.Write(obj.method)
-	buf.Write([]byte(" "))
-	buf.Write(obj.path)
-	buf.Write([]byte(" "))
-	buf.Write(obj.version)
-	buf.Write([]byte("\r\n"))
-	buf.Write(headers)
-	buf.Write([]byte("\r\n\r\n"))
+	buf.Write(obj.RequestLine())
+	buf.Write(lineEnd(obj.httpLineEOL))
+	// an HTTP/0.9 request is the request line alone
+	if len(obj.version) == 0 && len(obj.headers) == 0 && obj.headerEnd == nil && len(obj.body) == 0 && obj.bodySource == nil {
+		return buf.Bytes()
+	}
+	buf.Write(bytes.Join(headerSlice, nil))
+	buf.Write(lineEnd(obj.headerEnd))
 	buf.Write(obj.body)
 
 	return buf.Bytes()
 }
 
-func trimSpaces(sl [][]byte) [][]byte {
-	res := [][]byte{}
-	for _, v := range sl {
-		v1 := bytes.TrimSpace(v)
-		if len(v1) == 0 {
-			continue
-		}
-		res = append(res, v1)
-	}
-	return res
-}
-
 func (obj Request) RawMethod() string {
 	lines := bytes.Split(obj.Rawdata, []byte("\n"))
 	if len(lines) == 0 {
@@ -218,6 +485,17 @@ func (obj *Request) SetConnectionClose() {
 	obj.SetHeader("connection", []byte("Connection"), []byte("close"))
 }
 
+// port returns the URL port, or the default port of its scheme.
+func (obj *Request) port() string {
+	if port := obj.URI.Port(); port != "" {
+		return port
+	}
+	if obj.URI.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
 func (obj *Request) FullPath() string {
 	path := obj.URI.RequestURI()
 	if obj.URI.Fragment == "" {
@@ -303,7 +581,9 @@ func PrepareRequest(req *Request) {
 	req.method = prepareBytes(req.method, req)
 	req.path = prepareBytes(req.path, req)
 	req.version = prepareBytes(req.version, req)
-	req.body = prepareBytes(req.body, req)
+	if !req.rawBody {
+		req.body = prepareBytes(req.body, req)
+	}
 	for k, v := range req.headers {
 		v.Key = prepareBytes(v.Key, req)
 		v.Value = prepareBytes(v.Value, req)
@@ -312,50 +592,66 @@ func PrepareRequest(req *Request) {
 	PrepareRequestVariables(req)
 }
 
+// NormalizeLineEndings converts data without any "\r\n" to CRLF line
+// endings, for requests typed in an editor. Data with at least one "\r\n"
+// is returned unchanged. ParseRawdata keeps line endings as they are.
+func NormalizeLineEndings(data []byte) []byte {
+	if bytes.Contains(data, []byte("\r\n")) {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
 func prepareBytes(data []byte, req *Request) []byte {
 	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
 	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
 }
 
 func PrepareRequestVariables(req *Request) {
-	// body first for CLEN
-	req.body = prepareBytesVariables(req.body, req)
-	idx := bytes.Index(req.body, []byte("||END||"))
-	if idx != -1 {
-		req.body = req.body[:idx]
+	// body first for ||END||
+	if !req.rawBody {
+		e := &variableExpander{req: req, keepEscapes: true, trackEnd: true, endAt: -1}
+		req.body, _, _ = e.expand(req.body, false)
+		if e.endAt != -1 {
+			req.body = req.body[:e.endAt]
+		}
 	}
 
-	req.method = prepareBytesVariables(req.method, req)
-	req.path = prepareBytesVariables(req.path, req)
-	req.version = prepareBytesVariables(req.version, req)
+	if req.httpLine != nil {
+		req.SetRequestLine(prepareBytesVariables(req.httpLine, req))
+	} else {
+		req.method = prepareBytesVariables(req.method, req)
+		req.path = prepareBytesVariables(req.path, req)
+		req.version = prepareBytesVariables(req.version, req)
+	}
 	for k, v := range req.headers {
-		v.Key = prepareBytesVariables(v.Key, req)
-		v.Value = prepareBytesVariables(v.Value, req)
+		if v.Raw != nil {
+			v.Raw = prepareBytesVariables(v.Raw, req)
+			v.Key, v.Value, v.Malformed = parseHeaderLine(v.Raw)
+		} else {
+			v.Key = prepareBytesVariables(v.Key, req)
+			v.Value = prepareBytesVariables(v.Value, req)
+		}
 		req.headers[k] = v
 	}
+
+	req.prepareErr = ResolveLengthMarkers(req)
 }
 
+// prepareBytesVariables expands the template variables in data, see
+// builtinVariables and Variables. Escapes and length markers are kept for
+// ResolveLengthMarkers.
 func prepareBytesVariables(data []byte, req *Request) []byte {
-	path := req.URI.Path
-	if path == "" {
-		path = "/"
-	}
-	data = bytes.ReplaceAll(data, []byte("||CR||"), []byte("\r"))
-	data = bytes.ReplaceAll(data, []byte("||LF||"), []byte("\n"))
-	data = bytes.ReplaceAll(data, []byte("||ABSURL||"), []byte(req.URL))
-	data = bytes.ReplaceAll(data, []byte("||HOST||"), []byte(req.URI.Hostname()))
-	data = bytes.ReplaceAll(data, []byte("||PATH||"), []byte(path))
-	data = bytes.ReplaceAll(data, []byte("||ESCAPEDPATH||"), []byte(req.URI.EscapedPath()))
-	data = bytes.ReplaceAll(data, []byte("||FULLPATH||"), []byte(req.FullPath()))
-	return bytes.ReplaceAll(data, []byte("||CLEN||"), []byte(fmt.Sprintf("%d", len(req.body))))
+	e := &variableExpander{req: req, keepEscapes: true, endAt: -1}
+	out, _, _ := e.expand(data, false)
+	return out
 }
 
+// ContentLengthCalculation resolves the length markers in Rawdata. The body
+// is everything after the first empty line, excluding trailing whitespace.
+// Rawdata is left unchanged if the markers are malformed.
 func ContentLengthCalculation(req *Request) {
-	parts := bytes.Split(bytes.TrimSpace(req.Rawdata), []byte("\r\n\r\n"))
-	if len(parts) < 2 {
-		req.Rawdata = bytes.ReplaceAll(req.Rawdata, []byte("||CLEN||"), []byte("0"))
-		return
+	if out, err := resolveRawLengthMarkers(req.Rawdata); err == nil {
+		req.Rawdata = out
 	}
-	l := len(bytes.Join(parts[1:], []byte("\r\n\r\n")))
-	req.Rawdata = bytes.ReplaceAll(req.Rawdata, []byte("||CLEN||"), []byte(fmt.Sprintf("%d", l)))
 }
@@ -36,8 +36,15 @@ func TestParseRawdata(t *testing.T) {
 			wantErr:    false,
 		},
 		{
-			name:       "invalid HTTP line - missing parts",
+			name:       "HTTP/0.9 line without version",
 			rawdata:    "GET /path\r\nHost: example.com\r\n\r\n",
+			wantMethod: "GET",
+			wantPath:   "/path",
+			wantErr:    false,
+		},
+		{
+			name:       "invalid HTTP line - empty",
+			rawdata:    "\r\nHost: example.com\r\n\r\n",
 			wantMethod: "",
 			wantPath:   "",
 			wantErr:    true,
@@ -620,29 +627,6 @@ func TestContentLengthCalculation(t *testing.T) {
 	}
 }
 
-func TestTrimSpaces(t *testing.T) {
-	input := [][]byte{
-		[]byte("  hello  "),
-		[]byte(""),
-		[]byte("   "),
-		[]byte("world"),
-	}
-
-	result := trimSpaces(input)
-
-	if len(result) != 2 {
-		t.Errorf("len(result) = %d, want 2", len(result))
-	}
-
-	if string(result[0]) != "hello" {
-		t.Errorf("result[0] = %q, want %q", result[0], "hello")
-	}
-
-	if string(result[1]) != "world" {
-		t.Errorf("result[1] = %q, want %q", result[1], "world")
-	}
-}
-
 func TestSetRawdata(t *testing.T) {
 	req := &Request{}
 
@@ -691,3 +675,256 @@ func TestParsedPath(t *testing.T) {
 func parseTestURL(rawURL string) (*url.URL, error) {
 	return url.Parse(rawURL)
 }
+
+func TestParseRawdata_LineEndings(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawdata  string
+		wantHost string
+		wantBody string
+		wantRaw  string
+	}{
+		{
+			name:     "CRLF",
+			rawdata:  "GET / HTTP/1.1\r\nHost: a\r\nX: 1\r\n\r\nbody",
+			wantHost: "a",
+			wantBody: "body",
+		},
+		{
+			name:     "bare LF header among CRLF",
+			rawdata:  "GET / HTTP/1.1\r\nHost: a\nX: 1\r\n\r\nbody",
+			wantHost: "a",
+			wantBody: "body",
+		},
+		{
+			name:     "LF boundary in mixed request",
+			rawdata:  "GET / HTTP/1.1\r\nHost: a\n\nbody\r\n",
+			wantHost: "a",
+			wantBody: "body\r\n",
+		},
+		{
+			name:     "bare CR kept in value",
+			rawdata:  "GET / HTTP/1.1\r\nHost: a\rX: 1\r\n\r\n",
+			wantHost: "a\rX: 1",
+			wantBody: "",
+		},
+		{
+			name:     "LF only kept",
+			rawdata:  "GET / HTTP/1.1\nHost: a\n\nbody",
+			wantHost: "a",
+			wantBody: "body",
+		},
+		{
+			name:     "no empty line",
+			rawdata:  "GET / HTTP/1.1\r\nHost: a",
+			wantHost: "a",
+			wantBody: "",
+			wantRaw:  "GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Rawdata: []byte(tt.rawdata)}
+			if err := req.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error: %v", err)
+			}
+
+			if got := string(req.headers["host"].Value); got != tt.wantHost {
+				t.Errorf("host = %q, want %q", got, tt.wantHost)
+			}
+			if string(req.body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", req.body, tt.wantBody)
+			}
+			wantRaw := tt.wantRaw
+			if wantRaw == "" {
+				wantRaw = tt.rawdata
+			}
+			if got := string(req.Bytes()); got != wantRaw {
+				t.Errorf("Bytes() = %q, want %q", got, wantRaw)
+			}
+		})
+	}
+}
+
+func TestParseRawdata_MalformedHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		line          string
+		key           string
+		wantKey       string
+		wantValue     string
+		wantMalformed bool
+	}{
+		{"no space after colon", "Host:a", "host", "Host", "a", false},
+		{"space before colon", "Host : a", "host ", "Host ", "a", true},
+		{"no colon", "JUNK", "junk", "JUNK", "", true},
+		{"empty name", ": a", "", "", "a", true},
+		{"folded value", "X-A: 1\r\n 2\r\n\t3", "x-a", "X-A", "1 2 3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawdata := "GET / HTTP/1.1\r\n" + tt.line + "\r\nX-Last: z\r\n\r\n"
+			req := &Request{Rawdata: []byte(rawdata)}
+			if err := req.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error: %v", err)
+			}
+
+			hl, ok := req.headers[tt.key]
+			if !ok {
+				t.Fatalf("header %q not found in %v", tt.key, req.headers)
+			}
+			if string(hl.Key) != tt.wantKey || string(hl.Value) != tt.wantValue || hl.Malformed != tt.wantMalformed {
+				t.Errorf("header = {%q %q %v}, want {%q %q %v}", hl.Key, hl.Value, hl.Malformed,
+					tt.wantKey, tt.wantValue, tt.wantMalformed)
+			}
+			if req.headers["x-last"].Pos != 1 {
+				t.Errorf("x-last Pos = %d, want 1", req.headers["x-last"].Pos)
+			}
+			if got := string(req.Bytes()); got != rawdata {
+				t.Errorf("Bytes() = %q, want %q", got, rawdata)
+			}
+		})
+	}
+}
+
+func TestRequest_EditRawHeader(t *testing.T) {
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost :a\r\nX-A: 1\n 2\r\n\r\n")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	req.SetHeader("x-a", []byte("X-A"), []byte("3"))
+	req.SetHeaderLine("x-b", []byte("X-B\tnocolon"))
+
+	want := "GET / HTTP/1.1\r\nHost :a\r\nX-A: 3\r\nX-B\tnocolon\r\n\r\n"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+	if !req.headers["x-b"].Malformed {
+		t.Error("x-b not marked malformed")
+	}
+}
+
+func TestPrepareRequestVariables_RawHeader(t *testing.T) {
+	req := &Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost : ||HOST||\r\nX-C: ||COUNTER:raw-header||\r\n\r\n"),
+		URL:     "https://example.com/",
+	}
+	req.SetVariables(NewVariables())
+	req.URI, _ = parseTestURL(req.URL)
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	PrepareRequestVariables(req)
+
+	want := "GET / HTTP/1.1\r\nHost : example.com\r\nX-C: 1\r\n\r\n"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+	if got := string(req.headers["x-c"].Value); got != "1" {
+		t.Errorf("x-c Value = %q, want 1", got)
+	}
+}
+
+func TestParseRawdata_RequestLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		rawdata     string
+		wantMethod  string
+		wantPath    string
+		wantVersion string
+		wantForm    TargetForm
+	}{
+		{"HTTP/0.9", "GET /\r\n", "GET", "/", "", OriginForm},
+		{"tabs", "GET\t/a\tHTTP/1.0\r\n\r\n", "GET", "/a", "HTTP/1.0", OriginForm},
+		{"spaces in target", "GET /a b  c HTTP/1.1\r\n\r\n", "GET", "/a b  c", "HTTP/1.1", OriginForm},
+		{"absolute form", "GET http://example.com/x HTTP/1.1\r\n\r\n", "GET", "http://example.com/x", "HTTP/1.1", AbsoluteForm},
+		{"authority form", "CONNECT example.com:443 HTTP/1.1\r\n\r\n", "CONNECT", "example.com:443", "HTTP/1.1", AuthorityForm},
+		{"asterisk form", "OPTIONS * HTTP/1.1\r\n\r\n", "OPTIONS", "*", "HTTP/1.1", AsteriskForm},
+		{"garbage version", "GET / HTTP/9.x!\r\n\r\n", "GET", "/", "HTTP/9.x!", OriginForm},
+		{"other form", "GET foo HTTP/2.0\r\n\r\n", "GET", "foo", "HTTP/2.0", OtherForm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Rawdata: []byte(tt.rawdata)}
+			if err := req.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error: %v", err)
+			}
+
+			if string(req.method) != tt.wantMethod || string(req.path) != tt.wantPath || string(req.version) != tt.wantVersion {
+				t.Errorf("line = %q %q %q, want %q %q %q", req.method, req.path, req.version,
+					tt.wantMethod, tt.wantPath, tt.wantVersion)
+			}
+			if got := req.TargetForm(); got != tt.wantForm {
+				t.Errorf("TargetForm() = %d, want %d", got, tt.wantForm)
+			}
+			if got := string(req.Bytes()); got != tt.rawdata {
+				t.Errorf("Bytes() = %q, want %q", got, tt.rawdata)
+			}
+		})
+	}
+}
+
+func TestRequest_SetRequestLineParts(t *testing.T) {
+	req := &Request{Rawdata: []byte("GET  /a  HTTP/1.1\r\nHost: x\r\n\r\n")}
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	req.SetVersion([]byte("HTTP/1.0"))
+	if got := string(req.RequestLine()); got != "GET /a HTTP/1.0" {
+		t.Errorf("RequestLine() = %q", got)
+	}
+
+	req.SetVersion(nil)
+	req.SetPath([]byte("/b"))
+	if got := string(req.RequestLine()); got != "GET /b" {
+		t.Errorf("RequestLine() = %q", got)
+	}
+
+	req.SetRequestLine([]byte("POST\t/c HTTP/1.1 extra"))
+	if string(req.method) != "POST" || string(req.path) != "/c HTTP/1.1" || string(req.version) != "extra" {
+		t.Errorf("line = %q %q %q", req.method, req.path, req.version)
+	}
+	want := "POST\t/c HTTP/1.1 extra\r\nHost: x\r\n\r\n"
+	if got := string(req.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestPrepareRequestVariables_RequestLine(t *testing.T) {
+	req := &Request{Rawdata: []byte("GET  ||PATH||\r\n"), URL: "http://example.com/x"}
+	req.URI, _ = parseTestURL(req.URL)
+	if err := req.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+
+	PrepareRequestVariables(req)
+
+	if got := string(req.Bytes()); got != "GET  /x\r\n" {
+		t.Errorf("Bytes() = %q", got)
+	}
+	if string(req.path) != "/x" {
+		t.Errorf("path = %q, want /x", req.path)
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"GET / HTTP/1.1\nHost: a\n\nbody", "GET / HTTP/1.1\r\nHost: a\r\n\r\nbody"},
+		{"GET / HTTP/1.1\r\nHost: a\n\n", "GET / HTTP/1.1\r\nHost: a\n\n"},
+		{"GET /", "GET /"},
+	}
+	for _, tt := range tests {
+		if got := string(NormalizeLineEndings([]byte(tt.input))); got != tt.want {
+			t.Errorf("NormalizeLineEndings(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
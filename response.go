@@ -3,28 +3,46 @@ package rawhttp
 import (
 	"bufio"
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
 	"io"
 	"net/http"
 	"strings"
 	"time"
-
-	"github.com/andybalholm/brotli"
 )
 
 type Response struct {
 	Rawdata []byte
+	// Request is the request the response answers, set by Client.Do. Its
+	// method decides the body framing.
+	Request *Request
 
 	// Timing metrics (measured from after request write completes)
 	TimeToFirstByte time.Duration // Time until first response byte received
 	TimeToLastByte  time.Duration // Time until last response byte received
 
+	// MaxDecodedBytes caps the body decoded by ParseRawdata, protecting
+	// against decompression bombs. Zero means no limit.
+	MaxDecodedBytes int
+	// Truncated is set when a size limit cut the raw response or the
+	// decoded body short.
+	Truncated bool
+
+	// Attempts are the exchanges Client.Do made, the last one producing
+	// this response.
+	Attempts []Attempt
+
 	parsed     bool
+	parseErr   error
 	httpLine   []byte
 	statusCode int
+	header     http.Header
 	preBody    []byte
+	rawBody    []byte
 	body       []byte
+
+	headOffset  int
+	interim     []InterimResponse
+	extra       []byte
+	chunkLayout *chunkedLayout
 }
 
 func (obj *Client) NewResponse() *Response {
@@ -35,31 +53,58 @@ func NewResponse() *Response {
 	return &Response{}
 }
 
-// Reset clears the response state, allowing the Response to be reused.
+// Reset clears the response state except Request, allowing the Response
+// to be reused.
 // This is useful when retrying a request after a stale connection error.
 func (obj *Response) Reset() {
 	obj.Rawdata = nil
 	obj.TimeToFirstByte = 0
 	obj.TimeToLastByte = 0
+	obj.Truncated = false
+	obj.Attempts = nil
 	obj.parsed = false
+	obj.parseErr = nil
 	obj.httpLine = nil
 	obj.statusCode = 0
+	obj.header = nil
 	obj.preBody = nil
+	obj.rawBody = nil
 	obj.body = nil
+	obj.headOffset = 0
+	obj.interim = nil
+	obj.extra = nil
+	obj.chunkLayout = nil
 }
 
+// Body returns the body decoded from its transfer and content codings.
 func (obj *Response) Body() []byte {
 	obj.ParseRawdata()
 	return obj.body
 }
 
+// RawBody returns the body decoded from its transfer coding only, still
+// content encoded.
+func (obj *Response) RawBody() []byte {
+	obj.ParseRawdata()
+	return obj.rawBody
+}
+
 func (obj *Response) StatusCode() int {
 	obj.ParseRawdata()
 	return obj.statusCode
 }
 
+// Header returns the parsed response headers.
+func (obj *Response) Header() http.Header {
+	obj.ParseRawdata()
+	return obj.header
+}
+
 func (obj *Response) Bytes() []byte {
 	obj.ParseRawdata()
+	if obj.IsHTTP09() {
+		return obj.body
+	}
 
 	var buf bytes.Buffer
 	buf.Write(obj.preBody)
@@ -69,47 +114,190 @@ func (obj *Response) Bytes() []byte {
 	return buf.Bytes()
 }
 
+// IsHTTP09 reports whether the response has no status line. Such a
+// response is an HTTP/0.9 reply: all received bytes are the body, there are
+// no headers and StatusCode returns 0. Only a Request without a version
+// gets one, and never when the data starts like a status line in any case,
+// even a truncated one.
+func (obj *Response) IsHTTP09() bool {
+	if len(obj.Rawdata) == 0 || obj.Request == nil {
+		return false
+	}
+	obj.Request.ParseRawdata()
+	if len(obj.Request.version) > 0 {
+		return false
+	}
+	n := min(len(obj.Rawdata), len("HTTP/"))
+	return !bytes.EqualFold(obj.Rawdata[:n], []byte("HTTP/")[:n])
+}
+
+// ParseRawdata parses the status line, headers and body. The body is framed
+// by the rules of RFC 9112: responses to HEAD, 2xx responses to CONNECT and
+// 1xx, 204 and 304 responses have none, whatever their headers say. The
+// method is taken from Request, GET when it is nil. Interim 1xx responses
+// before the final one are skipped, see Interim. The body is
+// decoded from its content codings, stacked codings in reverse order.
+// Decoding errors do not stop parsing: the response is parsed, Body returns
+// the still encoded body and the *ContentEncodingError is returned, also by
+// later calls. The same holds for a decoded body exceeding MaxDecodedBytes,
+// which is cut at the limit with a *LimitError.
 func (obj *Response) ParseRawdata() error {
 	if obj.parsed {
+		return obj.parseErr
+	}
+	if obj.IsHTTP09() {
+		obj.preBody = nil
+		obj.header = http.Header{}
+		obj.rawBody = obj.Rawdata
+		obj.body = obj.Rawdata
+		obj.parsed = true
 		return nil
 	}
 
-	parts := bytes.SplitN(obj.Rawdata, []byte("\r\n\r\n"), 2)
-	obj.preBody = parts[0]
+	// a failed parse is repeated by the next call
+	obj.interim = nil
+	obj.extra = nil
+	obj.headOffset = 0
 
-	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewBuffer(obj.Rawdata)), &http.Request{})
-	if err != nil {
-		return err
+	rd := bytes.NewReader(obj.Rawdata)
+	br := bufio.NewReader(rd)
+	consumed := func() int {
+		return int(rd.Size()) - rd.Len() - br.Buffered()
 	}
+	method := obj.requestMethod()
 
-	var bodyReader io.Reader = resp.Body
-
-	// Handle different compression types
-	switch resp.Header.Get("Content-Encoding") {
-	case "gzip":
-		gzReader, err := gzip.NewReader(resp.Body)
+	var resp *http.Response
+	for {
+		obj.headOffset = consumed()
+		var err error
+		resp, err = http.ReadResponse(br, &http.Request{Method: method})
 		if err != nil {
-			panic(err)
+			return err
 		}
-		defer gzReader.Close()
-		bodyReader = gzReader
-	case "br":
-		bodyReader = brotli.NewReader(resp.Body)
-	case "deflate":
-		bodyReader = flate.NewReader(resp.Body)
+		// interim responses precede the final one, 101 ends the exchange
+		if resp.StatusCode/100 != 1 || resp.StatusCode == http.StatusSwitchingProtocols {
+			break
+		}
+		obj.interim = append(obj.interim, InterimResponse{StatusCode: resp.StatusCode, Header: resp.Header})
 	}
 
-	obj.body, err = io.ReadAll(bodyReader)
+	head := obj.Rawdata[obj.headOffset:]
+	obj.preBody = head[:max(headerSize(head), 0)]
+	obj.preBody = bytes.TrimSuffix(obj.preBody, []byte("\n"))
+	obj.preBody = bytes.TrimSuffix(obj.preBody, []byte("\r"))
+
+	defer resp.Body.Close()
+	// set before reading the body, so Chunks can inspect a body net/http
+	// rejects
+	obj.statusCode = resp.StatusCode
+	obj.header = resp.Header
+	// net/http frames HEAD, 1xx, 204 and 304 itself but not a successful
+	// CONNECT, after which the connection is a tunnel
+	if !obj.hasBody() {
+		resp.Body = http.NoBody
+	}
+	var err error
+	obj.rawBody, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	if n := consumed(); n < len(obj.Rawdata) {
+		obj.extra = obj.Rawdata[n:]
+	}
 
-	obj.statusCode = resp.StatusCode
+	obj.body, obj.parseErr = obj.decodeRawBody(contentEncodings(resp.Header))
 
 	obj.parsed = true
 
-	return nil
+	return obj.parseErr
+}
+
+// BodyError reports whether the error of ParseRawdata concerns the body
+// only: the status line and headers were parsed, and the body could not be
+// decoded or exceeded MaxDecodedBytes.
+func (obj *Response) BodyError() bool {
+	obj.ParseRawdata()
+	return obj.parsed && obj.parseErr != nil
+}
+
+// InterimResponse is a 1xx response received before the final one, e.g.
+// "100 Continue" or "103 Early Hints".
+type InterimResponse struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// Interim returns the interim responses preceding the final response.
+func (obj *Response) Interim() []InterimResponse {
+	obj.ParseRawdata()
+	return obj.interim
+}
+
+// Extra returns the bytes received after the end of the response: a
+// pipelined or smuggled response, or the first tunnel bytes after a
+// successful CONNECT.
+func (obj *Response) Extra() []byte {
+	obj.ParseRawdata()
+	return obj.extra
+}
+
+// Next returns the response in Extra, answering the same Request, or nil
+// when there are no extra bytes. Responses received together on a
+// keep-alive connection are split by calling Next until it returns nil.
+func (obj *Response) Next() *Response {
+	if len(obj.Extra()) == 0 {
+		return nil
+	}
+	return &Response{Rawdata: obj.extra, Request: obj.Request, MaxDecodedBytes: obj.MaxDecodedBytes}
+}
+
+// hasBody reports whether the framing rules allow a body.
+func (obj *Response) hasBody() bool {
+	method := obj.requestMethod()
+	switch {
+	case method == http.MethodHead:
+		return false
+	case method == http.MethodConnect && obj.statusCode/100 == 2:
+		return false
+	case obj.statusCode/100 == 1, obj.statusCode == http.StatusNoContent, obj.statusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func (obj *Response) requestMethod() string {
+	if obj.Request == nil {
+		return ""
+	}
+	obj.Request.ParseRawdata()
+	return string(obj.Request.method)
+}
+
+func (obj *Response) decodeRawBody(codings []string) ([]byte, error) {
+	max := obj.MaxDecodedBytes
+	if len(codings) == 0 && (max <= 0 || len(obj.rawBody) <= max) {
+		return obj.rawBody, nil
+	}
+
+	dec, err := decodeBody(bytes.NewReader(obj.rawBody), codings)
+	if err != nil {
+		return obj.rawBody, err
+	}
+	defer dec.Close()
+
+	var r io.Reader = dec
+	if max > 0 {
+		r = io.LimitReader(dec, int64(max)+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return obj.rawBody, err
+	}
+	if max > 0 && len(body) > max {
+		obj.Truncated = true
+		return body[:max], &LimitError{Kind: LimitDecoded, Limit: max}
+	}
+	return body, nil
 }
 
 func (obj *Client) NewRequestResponse() (*Request, *Response) {
@@ -287,3 +287,206 @@ func TestClient_NewRequestResponse(t *testing.T) {
 		t.Error("NewRequestResponse() returned nil response")
 	}
 }
+
+func TestResponse_HTTP09(t *testing.T) {
+	resp := &Response{Rawdata: []byte("<html>hello</html>"), Request: &Request{Rawdata: []byte("GET /\r\n")}}
+
+	if err := resp.ParseRawdata(); err != nil {
+		t.Fatalf("ParseRawdata() error: %v", err)
+	}
+	if !resp.IsHTTP09() {
+		t.Error("IsHTTP09() = false, want true")
+	}
+	if resp.StatusCode() != 0 || len(resp.Header()) != 0 {
+		t.Errorf("StatusCode() = %d, Header() = %v", resp.StatusCode(), resp.Header())
+	}
+	if got := string(resp.Body()); got != "<html>hello</html>" {
+		t.Errorf("Body() = %q", got)
+	}
+	if got := string(resp.Bytes()); got != "<html>hello</html>" {
+		t.Errorf("Bytes() = %q", got)
+	}
+}
+
+func TestResponse_IsHTTP09(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		rawdata string
+		want    bool
+	}{
+		{"no request", "", "<html>hello</html>", false},
+		{"empty", "GET /\r\n", "", false},
+		{"status line", "GET /\r\n", "HTTP/1.1 200 OK\r\n\r\n", false},
+		{"lower case status line", "GET /\r\n", "http/1.1 200 OK\r\n\r\n", false},
+		{"truncated status line", "GET /\r\n", "HTT", false},
+		{"request without version", "GET /\r\n", "<html>hello</html>", true},
+		{"request with version", "GET / HTTP/1.1\r\nHost: a\r\n\r\n", "<html>hello</html>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Rawdata: []byte(tt.rawdata)}
+			if tt.request != "" {
+				resp.Request = &Request{Rawdata: []byte(tt.request)}
+			}
+			if got := resp.IsHTTP09(); got != tt.want {
+				t.Errorf("IsHTTP09() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponse_GarbageWithoutRequest(t *testing.T) {
+	resp := &Response{Rawdata: []byte("garbage\r\n\r\n")}
+	if err := resp.ParseRawdata(); err == nil {
+		t.Errorf("ParseRawdata() error = nil, StatusCode() = %d, want a parse error", resp.StatusCode())
+	}
+}
+
+func TestResponse_BodyError(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawdata string
+		want    bool
+	}{
+		{"ok", "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", false},
+		{"undecodable body", "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: 7\r\n\r\nnotgzip", true},
+		{"invalid status line", "HTTP/1.1 abc\r\n\r\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Rawdata: []byte(tt.rawdata)}
+			if got := resp.BodyError(); got != tt.want {
+				t.Errorf("BodyError() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponse_MethodFraming(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		rawdata     string
+		wantStatus  int
+		wantBody    string
+		wantExtra   string
+		wantInterim []int
+	}{
+		{
+			name:       "GET reads the body",
+			method:     "GET",
+			rawdata:    "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+			wantStatus: 200,
+			wantBody:   "hello",
+		},
+		{
+			name:       "HEAD has no body",
+			method:     "HEAD",
+			rawdata:    "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nHTTP/1.1 404 Not Found\r\n\r\n",
+			wantStatus: 200,
+			wantExtra:  "HTTP/1.1 404 Not Found\r\n\r\n",
+		},
+		{
+			name:       "no request",
+			rawdata:    "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+			wantStatus: 200,
+			wantBody:   "hello",
+		},
+		{
+			name:       "CONNECT 2xx is a tunnel",
+			method:     "CONNECT",
+			rawdata:    "HTTP/1.1 200 Connection Established\r\nContent-Length: 5\r\n\r\n\x16\x03\x01tls",
+			wantStatus: 200,
+			wantExtra:  "\x16\x03\x01tls",
+		},
+		{
+			name:       "CONNECT error has a body",
+			method:     "CONNECT",
+			rawdata:    "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 4\r\n\r\nauth",
+			wantStatus: 407,
+			wantBody:   "auth",
+		},
+		{
+			name:       "204 ignores Content-Length",
+			method:     "GET",
+			rawdata:    "HTTP/1.1 204 No Content\r\nContent-Length: 5\r\n\r\nhello",
+			wantStatus: 204,
+			wantExtra:  "hello",
+		},
+		{
+			name:       "304 ignores Content-Length",
+			method:     "GET",
+			rawdata:    "HTTP/1.1 304 Not Modified\r\nContent-Length: 5\r\n\r\n",
+			wantStatus: 304,
+		},
+		{
+			name:        "interim responses are skipped",
+			method:      "POST",
+			rawdata:     "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok",
+			wantStatus:  201,
+			wantBody:    "ok",
+			wantInterim: []int{100, 103},
+		},
+		{
+			name:       "101 is final",
+			method:     "GET",
+			rawdata:    "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n\x81\x02hi",
+			wantStatus: 101,
+			wantExtra:  "\x81\x02hi",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Rawdata: []byte(tt.rawdata)}
+			if tt.method != "" {
+				resp.Request = &Request{Rawdata: []byte(tt.method + " / HTTP/1.1\r\nHost: example.com\r\n\r\n")}
+			}
+			if err := resp.ParseRawdata(); err != nil {
+				t.Fatalf("ParseRawdata() error: %v", err)
+			}
+			if resp.StatusCode() != tt.wantStatus {
+				t.Errorf("StatusCode() = %d, want %d", resp.StatusCode(), tt.wantStatus)
+			}
+			if string(resp.Body()) != tt.wantBody {
+				t.Errorf("Body() = %q, want %q", resp.Body(), tt.wantBody)
+			}
+			if string(resp.Extra()) != tt.wantExtra {
+				t.Errorf("Extra() = %q, want %q", resp.Extra(), tt.wantExtra)
+			}
+			var interim []int
+			for _, r := range resp.Interim() {
+				interim = append(interim, r.StatusCode)
+			}
+			if fmt.Sprint(interim) != fmt.Sprint(tt.wantInterim) {
+				t.Errorf("Interim() = %v, want %v", interim, tt.wantInterim)
+			}
+		})
+	}
+}
+
+func TestResponse_Next(t *testing.T) {
+	resp := &Response{
+		Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nabc" +
+			"HTTP/1.1 404 Not Found\r\nContent-Length: 4\r\n\r\nnope" +
+			"HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n\r\n"),
+		Request: &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")},
+	}
+
+	var got []string
+	for r := resp; r != nil; r = r.Next() {
+		got = append(got, fmt.Sprintf("%d:%s", r.StatusCode(), r.Body()))
+	}
+	if want := "[200:abc 404:nope 500:]"; fmt.Sprint(got) != want {
+		t.Errorf("responses = %v, want %s", got, want)
+	}
+}
+
+func TestResponse_InterimRepeatedParse(t *testing.T) {
+	resp := &Response{Rawdata: []byte("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nabc")}
+	for i := range 3 {
+		if got := len(resp.Interim()); got != 1 {
+			t.Fatalf("call %d: len(Interim()) = %d, want 1", i, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package rawhttp
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = 10 * time.Second
+)
+
+var (
+	// DefaultRetryErrors are the NetError kinds retried when
+	// RetryPolicy.Errors is nil: failures to connect and connections
+	// closed before the response.
+	DefaultRetryErrors = []NetErrorKind{NetConnectRefused, NetConnectTimeout, NetConnect, NetRead, NetStaleConn}
+	// DefaultRetryStatusCodes are the statuses retried when
+	// RetryPolicy.StatusCodes is nil.
+	DefaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+)
+
+// idempotentMethods may be sent again without changing the outcome.
+var idempotentMethods = []string{"GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE"}
+
+// RetryPolicy makes Client.Do repeat an exchange that failed with a network
+// error or a retryable status. The zero value never retries.
+//
+// Requests with a body source are not retried since the source is
+// consumed, and neither are CONNECT requests.
+type RetryPolicy struct {
+	// MaxAttempts is the number of exchanges including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the second attempt. It doubles for
+	// every further attempt, up to MaxBackoff. Default:
+	// DefaultRetryBackoff and DefaultRetryMaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each delay that is randomised, between 0
+	// and 1. With 0.5 a delay of 1s becomes 0.5s to 1s.
+	Jitter float64
+
+	// Errors are the NetError kinds retried. Default: DefaultRetryErrors.
+	Errors []NetErrorKind
+	// StatusCodes are the response statuses retried. Default:
+	// DefaultRetryStatusCodes.
+	StatusCodes []int
+	// IgnoreRetryAfter disables Retry-After. Otherwise a retried response
+	// with Retry-After waits that long instead of the backoff, and is not
+	// retried when it asks for more than MaxBackoff.
+	IgnoreRetryAfter bool
+
+	// AllowNonIdempotent retries methods other than GET, HEAD, OPTIONS,
+	// TRACE, PUT and DELETE.
+	AllowNonIdempotent bool
+}
+
+// Attempt is one exchange made by Client.Do.
+type Attempt struct {
+	// Delay is the wait before the attempt.
+	Delay time.Duration
+	// Duration is the time the exchange took.
+	Duration time.Duration
+	// StatusCode is the response status, zero when Err is set.
+	StatusCode int
+	Err        error
+}
+
+// retryable reports whether the request may be sent again after a failure.
+func (obj *RetryPolicy) retryable(req *Request) bool {
+	if obj.MaxAttempts < 2 || req.bodySource != nil {
+		return false
+	}
+	method := string(req.method)
+	if method == "CONNECT" {
+		return false
+	}
+	return obj.AllowNonIdempotent || slices.Contains(idempotentMethods, method)
+}
+
+// next returns the delay before attempt n+1 after attempt n ended with resp
+// and err, and false when there is to be no further attempt.
+func (obj *RetryPolicy) next(n int, resp *Response, err error) (time.Duration, bool) {
+	if n >= obj.MaxAttempts {
+		return 0, false
+	}
+
+	maxBackoff := obj.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	if err != nil {
+		kinds := obj.Errors
+		if kinds == nil {
+			kinds = DefaultRetryErrors
+		}
+		var nerr *NetError
+		if !errors.As(err, &nerr) || !slices.Contains(kinds, nerr.Kind) {
+			return 0, false
+		}
+		return obj.backoff(n, maxBackoff), true
+	}
+
+	codes := obj.StatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	if !slices.Contains(codes, resp.StatusCode()) {
+		return 0, false
+	}
+	if !obj.IgnoreRetryAfter {
+		if delay, ok := retryAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+			return delay, delay <= maxBackoff
+		}
+	}
+	return obj.backoff(n, maxBackoff), true
+}
+
+// backoff returns the jittered delay after attempt n.
+func (obj *RetryPolicy) backoff(n int, maxBackoff time.Duration) time.Duration {
+	delay := obj.Backoff
+	if delay == 0 {
+		delay = DefaultRetryBackoff
+	}
+	for i := 1; i < n && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+	if jitter := min(max(obj.Jitter, 0), 1); jitter > 0 {
+		delay -= time.Duration(jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// retryAfter parses a Retry-After value, either seconds or an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		if int64(secs) > math.MaxInt64/int64(time.Second) {
+			return math.MaxInt64, true
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
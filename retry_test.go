@@ -0,0 +1,203 @@
+package rawhttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for n, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		60: time.Second,
+	} {
+		if got := policy.backoff(n, policy.MaxBackoff); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for range 100 {
+		if got := policy.backoff(2, policy.MaxBackoff); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("jittered backoff(2) = %v, want 100ms to 200ms", got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{" 120 ", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %t, want %v, %t", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestClient_Do_Retry(t *testing.T) {
+	unavailable := "HTTP/1.1 503 Service Unavailable\r\nConnection: close\r\nContent-Length: 0\r\n\r\n"
+	ok := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	get := "GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"
+	post := "POST / HTTP/1.1\r\nHost: ||HOST||\r\nContent-Length: 0\r\n\r\n"
+
+	tests := []struct {
+		name         string
+		request      string
+		policy       RetryPolicy
+		responses    []string
+		wantStatuses []int
+	}{
+		{
+			name:         "no policy",
+			request:      get,
+			responses:    []string{unavailable, ok},
+			wantStatuses: []int{503},
+		},
+		{
+			name:         "retried status",
+			request:      get,
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			responses:    []string{unavailable, unavailable, ok},
+			wantStatuses: []int{503, 503, 200},
+		},
+		{
+			name:         "attempts exhausted",
+			request:      get,
+			policy:       RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+			responses:    []string{unavailable, unavailable, ok},
+			wantStatuses: []int{503, 503},
+		},
+		{
+			name:         "status not retried",
+			request:      get,
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, StatusCodes: []int{502}},
+			responses:    []string{unavailable, ok},
+			wantStatuses: []int{503},
+		},
+		{
+			name:    "retry after",
+			request: get,
+			policy:  RetryPolicy{MaxAttempts: 2, Backoff: time.Hour},
+			responses: []string{
+				"HTTP/1.1 429 Too Many Requests\r\nRetry-After: 0\r\nConnection: close\r\nContent-Length: 0\r\n\r\n",
+				ok,
+			},
+			wantStatuses: []int{429, 200},
+		},
+		{
+			name:    "retry after too long",
+			request: get,
+			policy:  RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+			responses: []string{
+				"HTTP/1.1 429 Too Many Requests\r\nRetry-After: 3600\r\nConnection: close\r\nContent-Length: 0\r\n\r\n",
+				ok,
+			},
+			wantStatuses: []int{429},
+		},
+		{
+			name:         "non-idempotent",
+			request:      post,
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			responses:    []string{unavailable, ok},
+			wantStatuses: []int{503},
+		},
+		{
+			name:         "non-idempotent allowed",
+			request:      post,
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, AllowNonIdempotent: true},
+			responses:    []string{unavailable, ok},
+			wantStatuses: []int{503, 200},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scripts []rawhttptest.Script
+			for _, r := range tt.responses {
+				scripts = append(scripts, rawhttptest.Script{rawhttptest.ExpectRequest(), rawhttptest.Write(r)})
+			}
+			srv := rawhttptest.NewServer(scripts...)
+			defer srv.Close()
+
+			client := NewDefaultClient()
+			defer client.Close()
+			client.Retry = tt.policy
+
+			resp := &Response{}
+			req := &Request{Rawdata: []byte(tt.request), URL: srv.URL + "/"}
+			if err := client.Do(req, resp); err != nil {
+				t.Fatalf("Do() error: %v", err)
+			}
+
+			var statuses []int
+			for _, a := range resp.Attempts {
+				statuses = append(statuses, a.StatusCode)
+			}
+			if !slices.Equal(statuses, tt.wantStatuses) {
+				t.Errorf("attempt statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+			if want := tt.wantStatuses[len(tt.wantStatuses)-1]; resp.StatusCode() != want {
+				t.Errorf("StatusCode() = %d, want %d", resp.StatusCode(), want)
+			}
+			if len(resp.Attempts) > 1 && resp.Attempts[1].Delay <= 0 && tt.name != "retry after" {
+				t.Errorf("Attempts[1].Delay = %v, want a backoff", resp.Attempts[1].Delay)
+			}
+		})
+	}
+}
+
+func TestClient_Do_RetryNetError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+	client.Retry = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	resp := &Response{}
+	req := &Request{Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"), URL: "http://" + addr + "/"}
+	err = client.Do(req, resp)
+	if !errors.Is(err, NetConnectRefused) {
+		t.Fatalf("Do() error = %v, want NetConnectRefused", err)
+	}
+	if len(resp.Attempts) != 3 {
+		t.Fatalf("len(Attempts) = %d, want 3", len(resp.Attempts))
+	}
+	for i, a := range resp.Attempts {
+		if !errors.Is(a.Err, NetConnectRefused) || a.StatusCode != 0 {
+			t.Errorf("Attempts[%d] = %+v", i, a)
+		}
+	}
+
+	client.Retry.Errors = []NetErrorKind{NetDNS}
+	resp = &Response{}
+	client.Do(req, resp)
+	if len(resp.Attempts) != 1 {
+		t.Errorf("len(Attempts) = %d, want 1 for an error kind not retried", len(resp.Attempts))
+	}
+}
@@ -0,0 +1,321 @@
+package rawhttp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultStreamRetainBytes = 64 << 10
+	streamBufferSize         = 32 << 10
+)
+
+// BodyStream reads the decoded body of a response received by DoStream.
+// It must be closed to release the connection.
+type BodyStream struct {
+	resp     *Response
+	httpResp *http.Response
+	body     io.ReadCloser
+	raw      *eofReader
+	br       *bufio.Reader
+	release  func(reuse bool)
+	closed   bool
+}
+
+// DoStream sends the request and returns once the response headers are
+// read. The status code and headers of resp are set; the body is read from
+// the returned stream, decoded from its transfer and content codings.
+//
+// Only the first StreamRetainBytes raw bytes are kept in resp.Rawdata, and
+// resp.Body stays empty. Timeout limits each read instead of the whole
+// exchange, so long downloads are not cut off. CONNECT requests are not
+// supported.
+func (obj *Client) DoStream(req *Request, resp *Response) (*BodyStream, error) {
+	resp.Request = req
+	if err := obj.prepare(req); err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(req.Rawdata, []byte("CONNECT ")) {
+		return nil, fmt.Errorf("%w: CONNECT is not supported by DoStream", InvalidRequestError)
+	}
+
+	if obj.proxyURI != nil {
+		conn, err := obj.dialProxy(req)
+		if err != nil {
+			return nil, err
+		}
+		return obj.stream(conn, req, resp, "")
+	}
+
+	var dialer func() (net.Conn, error)
+	switch req.URI.Scheme {
+	case "https":
+		dialer = func() (net.Conn, error) { return obj.httpsDialer().Dial("tcp", req.Addr(req.port())) }
+	case "http":
+		dialer = func() (net.Conn, error) { return obj.httpDialer().Dial("tcp", req.Addr(req.port())) }
+	default:
+		return nil, InvalidURLError
+	}
+
+	poolKey := PoolKey(req.URI.Scheme, req.URI.Hostname(), req.port())
+	// a body source is read only once, so it is sent on a fresh connection
+	var stale error
+	if obj.pool != nil && !obj.DisableKeepAlive && req.bodySource == nil {
+		if conn := obj.pool.Get(poolKey); conn != nil {
+			stream, err := obj.stream(conn, req, resp, poolKey)
+			if err = staleConnError(err); !errors.Is(err, NetStaleConn) {
+				return stream, err
+			}
+			stale = err
+			resp.Reset()
+		}
+	}
+
+	conn, err := dialer()
+	if err != nil {
+		return nil, redialError(stale, err)
+	}
+	return obj.stream(conn, req, resp, poolKey)
+}
+
+// DoStreamFunc is DoStream calling fn with each piece of the decoded body
+// until the body ends or fn returns an error. The chunk is only valid
+// during the call.
+func (obj *Client) DoStreamFunc(req *Request, resp *Response, fn func(chunk []byte) error) error {
+	stream, err := obj.DoStream(req, resp)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	buf := make([]byte, streamBufferSize)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if err := fn(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// stream writes the request and reads the response headers. An empty
+// poolKey disables connection reuse.
+func (obj *Client) stream(conn net.Conn, req *Request, resp *Response, poolKey string) (*BodyStream, error) {
+	release := func(reuse bool) {
+		reuse = reuse && poolKey != "" && obj.pool != nil && !obj.DisableKeepAlive &&
+			!req.WantsClose() && !req.WantsUpgrade()
+		if !reuse || !obj.pool.Put(poolKey, conn) {
+			conn.Close()
+		}
+	}
+
+	addr := req.Addr(req.port())
+	if _, err := req.WriteTo(conn); err != nil {
+		release(false)
+		return nil, netError(PhaseWrite, addr, err)
+	}
+
+	limit := obj.StreamRetainBytes
+	if limit == 0 {
+		limit = DefaultStreamRetainBytes
+	}
+	rr := &retainReader{
+		conn:        conn,
+		resp:        resp,
+		limit:       limit,
+		timeout:     obj.Timeout,
+		start:       time.Now(),
+		maxHeader:   obj.MaxHeaderBytes,
+		maxResponse: obj.MaxResponseBytes,
+	}
+	br := bufio.NewReaderSize(rr, streamBufferSize)
+
+	var httpResp *http.Response
+	for {
+		headOffset := rr.read - br.Buffered()
+		rr.headStart = headOffset
+		var err error
+		httpResp, err = http.ReadResponse(br, &http.Request{Method: string(req.method)})
+		if err == nil && obj.MaxHeaderBytes > 0 && headerSize(resp.Rawdata[min(headOffset, len(resp.Rawdata)):]) > obj.MaxHeaderBytes {
+			err = &LimitError{Kind: LimitHeader, Limit: obj.MaxHeaderBytes}
+		}
+		if err != nil && rr.limited != nil {
+			// a line cut at the limit may also fail to parse
+			err = rr.limited
+		}
+		if err != nil {
+			release(false)
+			var lerr *LimitError
+			if errors.As(err, &lerr) {
+				if lerr.Kind == LimitHeader {
+					resp.Rawdata = resp.Rawdata[:min(len(resp.Rawdata), headOffset+lerr.Limit)]
+				}
+				resp.Truncated = true
+				return nil, lerr
+			}
+			if err == io.ErrUnexpectedEOF && len(resp.Rawdata) == 0 {
+				err = io.EOF
+			}
+			// a malformed head is not a network failure
+			var opErr *net.OpError
+			if err == io.EOF || isTimeoutError(err) || errors.As(err, &opErr) {
+				err = netError(PhaseRead, addr, err)
+			}
+			return nil, err
+		}
+		// skip interim responses as ParseRawdata does
+		if httpResp.StatusCode/100 != 1 || httpResp.StatusCode == http.StatusSwitchingProtocols {
+			resp.headOffset = min(headOffset, len(resp.Rawdata))
+			break
+		}
+		resp.interim = append(resp.interim, InterimResponse{StatusCode: httpResp.StatusCode, Header: httpResp.Header})
+	}
+	rr.headStart = -1
+
+	head := resp.Rawdata[resp.headOffset:]
+	if size := headerSize(head); size >= 0 {
+		head = bytes.TrimSuffix(bytes.TrimSuffix(head[:size], []byte("\n")), []byte("\r"))
+	}
+	resp.preBody = head
+	resp.statusCode = httpResp.StatusCode
+	resp.header = httpResp.Header
+	resp.parsed = true
+
+	raw := &eofReader{r: httpResp.Body}
+	body, err := decodeBody(raw, contentEncodings(httpResp.Header))
+	if err != nil {
+		release(false)
+		return nil, err
+	}
+	return &BodyStream{
+		resp:     resp,
+		httpResp: httpResp,
+		body:     body,
+		raw:      raw,
+		br:       br,
+		release:  release,
+	}, nil
+}
+
+// Response returns the response passed to DoStream.
+func (obj *BodyStream) Response() *Response {
+	return obj.resp
+}
+
+func (obj *BodyStream) Read(p []byte) (int, error) {
+	if obj.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return obj.body.Read(p)
+}
+
+// Close releases the connection. It goes back to the pool only when the
+// body was read to its end and nothing else was received after it.
+func (obj *BodyStream) Close() error {
+	if obj.closed {
+		return nil
+	}
+	obj.closed = true
+	obj.body.Close()
+	obj.release(obj.raw.eof && !obj.httpResp.Close && obj.br.Buffered() == 0)
+	return nil
+}
+
+// retainReader reads from the connection, renewing the read deadline on
+// every read, records the timings and keeps the first limit bytes in
+// Rawdata. A negative limit keeps everything.
+type retainReader struct {
+	conn     net.Conn
+	resp     *Response
+	limit    int
+	timeout  time.Duration
+	start    time.Time
+	received bool
+	// read is the number of bytes read from the connection
+	read int
+
+	// maxHeader and maxResponse are Client.MaxHeaderBytes and
+	// Client.MaxResponseBytes. headStart is the offset of the head being
+	// read, -1 once the body is read.
+	maxHeader   int
+	maxResponse int
+	headStart   int
+	// limited is the limit reads stopped at
+	limited *LimitError
+}
+
+func (obj *retainReader) Read(p []byte) (int, error) {
+	if stop, err := obj.stop(); err != nil {
+		if obj.read >= stop {
+			obj.resp.Truncated = true
+			obj.limited = err
+			return 0, err
+		}
+		p = p[:min(len(p), stop-obj.read)]
+	}
+	if obj.timeout > 0 {
+		obj.conn.SetReadDeadline(time.Now().Add(obj.timeout))
+	}
+	n, err := obj.conn.Read(p)
+	obj.read += n
+	if n > 0 {
+		now := time.Now()
+		if !obj.received {
+			obj.resp.TimeToFirstByte = now.Sub(obj.start)
+			obj.received = true
+		}
+		obj.resp.TimeToLastByte = now.Sub(obj.start)
+
+		keep := n
+		if obj.limit >= 0 {
+			keep = min(n, max(obj.limit-len(obj.resp.Rawdata), 0))
+		}
+		obj.resp.Rawdata = append(obj.resp.Rawdata, p[:keep]...)
+	}
+	return n, err
+}
+
+// stop returns the offset reads end at and the error reported there, or a
+// nil error when there is no limit.
+func (obj *retainReader) stop() (int, *LimitError) {
+	var stop int
+	var err *LimitError
+	if obj.maxResponse > 0 {
+		stop, err = obj.maxResponse, &LimitError{Kind: LimitResponse, Limit: obj.maxResponse}
+	}
+	if obj.maxHeader > 0 && obj.headStart >= 0 {
+		// leave room for the empty line ending the head, which the limit
+		// does not count
+		if end := obj.headStart + obj.maxHeader + 2; err == nil || end < stop {
+			stop, err = end, &LimitError{Kind: LimitHeader, Limit: obj.maxHeader}
+		}
+	}
+	return stop, err
+}
+
+// eofReader records whether the underlying reader reached its end.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (obj *eofReader) Read(p []byte) (int, error) {
+	n, err := obj.r.Read(p)
+	if err == io.EOF {
+		obj.eof = true
+	}
+	return n, err
+}
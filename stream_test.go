@@ -0,0 +1,348 @@
+package rawhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.String()
+}
+
+func TestClient_DoStream(t *testing.T) {
+	large := strings.Repeat("0123456789", 10000)
+	zipped := gzipString(t, "hello gzip")
+
+	tests := []struct {
+		name     string
+		method   string
+		response string
+		retain   int
+		wantBody string
+		wantRaw  int // -1: whole response
+		// wantInterim is the number of 1xx responses skipped
+		wantInterim int
+	}{
+		{
+			name:     "content-length",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+			wantBody: "hello",
+			wantRaw:  -1,
+		},
+		{
+			name:     "chunked",
+			response: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n",
+			wantBody: "abcde",
+			wantRaw:  -1,
+		},
+		{
+			name:     "gzip",
+			response: "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: " + strconv.Itoa(len(zipped)) + "\r\n\r\n" + zipped,
+			wantBody: "hello gzip",
+			wantRaw:  -1,
+		},
+		{
+			name:     "retain cap",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 100000\r\n\r\n" + large,
+			retain:   100,
+			wantBody: large,
+			wantRaw:  100,
+		},
+		{
+			name:     "retain everything",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 100000\r\n\r\n" + large,
+			retain:   -1,
+			wantBody: large,
+			wantRaw:  -1,
+		},
+		{
+			name:        "interim responses",
+			response:    "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			wantBody:    "ok",
+			wantRaw:     -1,
+			wantInterim: 2,
+		},
+		{
+			name:     "head",
+			method:   "HEAD",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n",
+			wantBody: "",
+			wantRaw:  -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rawhttptest.NewServer(rawhttptest.Script{
+				rawhttptest.ExpectRequest(),
+				rawhttptest.Write(tt.response),
+			})
+			defer srv.Close()
+
+			client := NewDefaultClient()
+			client.StreamRetainBytes = tt.retain
+			defer client.Close()
+
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := &Request{
+				Rawdata: []byte(method + " / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+				URL:     srv.URL + "/",
+			}
+			resp := &Response{}
+			stream, err := client.DoStream(req, resp)
+			if err != nil {
+				t.Fatalf("DoStream() error: %v", err)
+			}
+			defer stream.Close()
+
+			if resp.StatusCode() != 200 {
+				t.Errorf("StatusCode() = %d, want 200", resp.StatusCode())
+			}
+			if got := resp.Header().Get("Link"); got != "" || bytes.Contains(resp.preBody, []byte("HTTP/1.1 1")) {
+				t.Errorf("head of an interim response kept: %q", resp.preBody)
+			}
+			if got := len(resp.Interim()); got != tt.wantInterim {
+				t.Errorf("len(Interim()) = %d, want %d", got, tt.wantInterim)
+			}
+			body, err := io.ReadAll(stream)
+			if err != nil {
+				t.Fatalf("ReadAll() error: %v", err)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", truncate(body), truncate([]byte(tt.wantBody)))
+			}
+
+			want := tt.response
+			if tt.wantRaw >= 0 {
+				want = want[:tt.wantRaw]
+			}
+			if string(resp.Rawdata) != want {
+				t.Errorf("Rawdata = %q, want %q", truncate(resp.Rawdata), truncate([]byte(want)))
+			}
+			if len(resp.Body()) != 0 {
+				t.Errorf("Body() = %q, want empty", truncate(resp.Body()))
+			}
+		})
+	}
+}
+
+func TestClient_DoStream_KeepAlive(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none"),
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\ntwo"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	for _, want := range []string{"one", "two"} {
+		req := &Request{
+			Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+			URL:     srv.URL + "/",
+		}
+		var got []byte
+		err := client.DoStreamFunc(req, &Response{}, func(chunk []byte) error {
+			got = append(got, chunk...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("DoStreamFunc() error: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("body = %q, want %q", got, want)
+		}
+	}
+
+	if n := len(srv.Conns()); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestClient_DoStream_UnreadBodyClosesConn(t *testing.T) {
+	srv := rawhttptest.NewServer(
+		rawhttptest.Script{
+			rawhttptest.ExpectRequest(),
+			rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 6\r\n\r\nabcdef"),
+		},
+		rawhttptest.Script{
+			rawhttptest.ExpectRequest(),
+			rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"),
+		},
+	)
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	newReq := func() *Request {
+		return &Request{
+			Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+			URL:     srv.URL + "/",
+		}
+	}
+
+	stream, err := client.DoStream(newReq(), &Response{})
+	if err != nil {
+		t.Fatalf("DoStream() error: %v", err)
+	}
+	stream.Read(make([]byte, 2))
+	stream.Close()
+
+	resp := &Response{}
+	if err := client.Do(newReq(), resp); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	if string(resp.Body()) != "ok" {
+		t.Errorf("Body() = %q, want %q", resp.Body(), "ok")
+	}
+	if n := len(srv.Conns()); n != 2 {
+		t.Errorf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestClient_DoStreamFunc_CallbackError(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+	})
+	defer srv.Close()
+
+	client := NewDefaultClient()
+	defer client.Close()
+
+	stop := errors.New("stop")
+	req := &Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	err := client.DoStreamFunc(req, &Response{}, func([]byte) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("DoStreamFunc() error = %v, want %v", err, stop)
+	}
+}
+
+func TestClient_DoStream_Limits(t *testing.T) {
+	pad := "HTTP/1.1 200 OK\r\n" + strings.Repeat("X-Pad: aaaaaaaaaa\r\n", 100)
+	tests := []struct {
+		name        string
+		response    string
+		maxResp     int
+		maxHeader   int
+		wantHeadErr bool
+		wantBodyErr bool
+		wantKind    LimitKind
+		wantRaw     string
+		wantBody    string
+	}{
+		{
+			name:        "endless headers",
+			response:    pad,
+			maxHeader:   64,
+			wantHeadErr: true,
+			wantKind:    LimitHeader,
+			wantRaw:     pad[:64],
+		},
+		{
+			name:        "headers over limit",
+			response:    "HTTP/1.1 200 OK\r\nX-Pad: aaaaaaaaaa\r\n\r\n",
+			maxHeader:   20,
+			wantHeadErr: true,
+			wantKind:    LimitHeader,
+			wantRaw:     "HTTP/1.1 200 OK\r\nX-Pad: aaaaaaaaaa\r\n"[:20],
+		},
+		{
+			name:      "headers at limit",
+			response:  "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			maxHeader: len("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n"),
+			wantRaw:   "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			wantBody:  "ok",
+		},
+		{
+			name:      "large body under header limit",
+			response:  "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("b", 100),
+			maxHeader: 64,
+			wantRaw:   "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("b", 100),
+			wantBody:  strings.Repeat("b", 100),
+		},
+		{
+			name:        "body over response limit",
+			response:    "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n0123456789",
+			maxResp:     40,
+			wantBodyErr: true,
+			wantKind:    LimitResponse,
+			wantRaw:     "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n0",
+			wantBody:    "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rawhttptest.NewServer(rawhttptest.Script{
+				rawhttptest.ExpectRequest(),
+				rawhttptest.Write(tt.response),
+			})
+			defer srv.Close()
+
+			client := NewDefaultClient()
+			client.MaxResponseBytes = tt.maxResp
+			client.MaxHeaderBytes = tt.maxHeader
+			defer client.Close()
+
+			req := &Request{
+				Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\n\r\n"),
+				URL:     srv.URL + "/",
+			}
+			resp := &Response{}
+			stream, err := client.DoStream(req, resp)
+			var body []byte
+			if err == nil {
+				body, err = io.ReadAll(stream)
+				stream.Close()
+				if tt.wantHeadErr {
+					t.Fatal("DoStream() succeeded, want a limit error")
+				}
+			}
+
+			var lerr *LimitError
+			if tt.wantHeadErr || tt.wantBodyErr {
+				if !errors.As(err, &lerr) || lerr.Kind != tt.wantKind {
+					t.Fatalf("error = %v, want %s limit", err, tt.wantKind)
+				}
+			} else if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if resp.Truncated != (tt.wantHeadErr || tt.wantBodyErr) {
+				t.Errorf("Truncated = %t", resp.Truncated)
+			}
+			if string(resp.Rawdata) != tt.wantRaw {
+				t.Errorf("Rawdata = %q, want %q", resp.Rawdata, tt.wantRaw)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func truncate(b []byte) []byte {
+	if len(b) > 64 {
+		return b[:64]
+	}
+	return b
+}
@@ -0,0 +1,147 @@
+package rawhttp
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// CharsetSource tells where the charset of a body was found.
+type CharsetSource int
+
+const (
+	// CharsetDefault: nothing declared, UTF-8 when the body is valid UTF-8
+	// and windows-1252 otherwise.
+	CharsetDefault CharsetSource = iota
+	CharsetBOM
+	CharsetHeader
+	CharsetMeta
+)
+
+func (obj CharsetSource) String() string {
+	switch obj {
+	case CharsetDefault:
+		return "default"
+	case CharsetBOM:
+		return "bom"
+	case CharsetHeader:
+		return "header"
+	case CharsetMeta:
+		return "meta"
+	}
+	return fmt.Sprintf("CharsetSource(%d)", int(obj))
+}
+
+// DecodedText is a body converted to UTF-8.
+type DecodedText struct {
+	Text string
+	// Charset is the WHATWG name of the charset used, e.g. "windows-1252".
+	Charset string
+	Source  CharsetSource
+	// Replaced is set when invalid sequences were replaced with U+FFFD.
+	Replaced bool
+}
+
+// metaScanBytes is how much of the body is searched for a meta charset.
+const metaScanBytes = 1024
+
+var metaCharsetRegexp = regexp.MustCompile(`(?i)<meta[^>]*?charset\s*=\s*["']?\s*([a-z0-9_:.+-]+)`)
+
+var boms = []struct {
+	bom     []byte
+	charset string
+}{
+	{[]byte{0xef, 0xbb, 0xbf}, "utf-8"},
+	{[]byte{0xfe, 0xff}, "utf-16be"},
+	{[]byte{0xff, 0xfe}, "utf-16le"},
+}
+
+// Text returns the decoded body converted to UTF-8. The charset is taken
+// from a byte order mark, then the Content-Type charset, then an HTML meta
+// tag in the first 1024 bytes; unknown labels are skipped.
+func (obj *Response) Text() DecodedText {
+	obj.ParseRawdata()
+	return DecodeText(obj.body, obj.header.Get("Content-Type"))
+}
+
+// DecodeText converts body to UTF-8 as Response.Text does.
+func DecodeText(body []byte, contentType string) DecodedText {
+	charset, source := detectCharset(body, contentType)
+	if source == CharsetBOM {
+		for _, b := range boms {
+			if b.charset == charset {
+				body = body[len(b.bom):]
+				break
+			}
+		}
+	}
+
+	if charset == "utf-8" {
+		return DecodedText{
+			Text:     strings.ToValidUTF8(string(body), "\uFFFD"),
+			Charset:  charset,
+			Source:   source,
+			Replaced: !utf8.Valid(body),
+		}
+	}
+
+	// detectCharset only returns names htmlindex knows
+	enc, _ := htmlindex.Get(charset)
+	out, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		out = []byte(strings.ToValidUTF8(string(out), "\uFFFD"))
+	}
+	return DecodedText{
+		Text:     string(out),
+		Charset:  charset,
+		Source:   source,
+		Replaced: err != nil || bytes.ContainsRune(out, utf8.RuneError),
+	}
+}
+
+func detectCharset(body []byte, contentType string) (string, CharsetSource) {
+	for _, b := range boms {
+		if bytes.HasPrefix(body, b.bom) {
+			return b.charset, CharsetBOM
+		}
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if name, ok := charsetName(params["charset"]); ok {
+			return name, CharsetHeader
+		}
+	}
+	if m := metaCharsetRegexp.FindSubmatch(body[:min(len(body), metaScanBytes)]); m != nil {
+		if name, ok := charsetName(string(m[1])); ok {
+			// a meta tag read as ASCII cannot declare UTF-16
+			if strings.HasPrefix(name, "utf-16") {
+				name = "utf-8"
+			}
+			return name, CharsetMeta
+		}
+	}
+	if utf8.Valid(body) {
+		return "utf-8", CharsetDefault
+	}
+	return "windows-1252", CharsetDefault
+}
+
+// charsetName returns the WHATWG name of a charset label.
+func charsetName(label string) (string, bool) {
+	if label == "" {
+		return "", false
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return "", false
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,141 @@
+package rawhttp
+
+import (
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		contentType  string
+		want         string
+		wantCharset  string
+		wantSource   CharsetSource
+		wantReplaced bool
+	}{
+		{
+			name:        "utf-8 default",
+			body:        "héllo",
+			want:        "héllo",
+			wantCharset: "utf-8",
+			wantSource:  CharsetDefault,
+		},
+		{
+			name:        "undeclared non utf-8",
+			body:        "caf\xe9",
+			want:        "café",
+			wantCharset: "windows-1252",
+			wantSource:  CharsetDefault,
+		},
+		{
+			name:        "latin-1 header",
+			body:        "caf\xe9",
+			contentType: "text/html; charset=ISO-8859-1",
+			want:        "café",
+			wantCharset: "windows-1252",
+			wantSource:  CharsetHeader,
+		},
+		{
+			name:        "quoted header charset",
+			body:        "\xcf\xf0\xe8\xe2\xe5\xf2",
+			contentType: `text/plain; charset="windows-1251"`,
+			want:        "Привет",
+			wantCharset: "windows-1251",
+			wantSource:  CharsetHeader,
+		},
+		{
+			name:        "shift_jis header",
+			body:        "\x93\xfa\x96\x7b",
+			contentType: "text/html; charset=Shift_JIS",
+			want:        "日本",
+			wantCharset: "shift_jis",
+			wantSource:  CharsetHeader,
+		},
+		{
+			name:        "meta charset",
+			body:        `<html><head><meta charset="windows-1251"></head>` + "\xcf\xf0\xe8\xe2\xe5\xf2",
+			contentType: "text/html",
+			want:        `<html><head><meta charset="windows-1251"></head>Привет`,
+			wantCharset: "windows-1251",
+			wantSource:  CharsetMeta,
+		},
+		{
+			name:        "meta http-equiv",
+			body:        `<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-2">` + "\xb1",
+			want:        `<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-2">ą`,
+			wantCharset: "iso-8859-2",
+			wantSource:  CharsetMeta,
+		},
+		{
+			name:        "unknown header label falls back to meta",
+			body:        `<meta charset="koi8-r">` + "\xf0",
+			contentType: "text/html; charset=bogus",
+			want:        `<meta charset="koi8-r">П`,
+			wantCharset: "koi8-r",
+			wantSource:  CharsetMeta,
+		},
+		{
+			name:        "bom overrides header",
+			body:        "\xef\xbb\xbfcaf\xc3\xa9",
+			contentType: "text/html; charset=windows-1252",
+			want:        "café",
+			wantCharset: "utf-8",
+			wantSource:  CharsetBOM,
+		},
+		{
+			name:        "utf-16le bom",
+			body:        "\xff\xfeh\x00i\x00",
+			want:        "hi",
+			wantCharset: "utf-16le",
+			wantSource:  CharsetBOM,
+		},
+		{
+			name:        "utf-16be bom",
+			body:        "\xfe\xff\x00h\x00i",
+			want:        "hi",
+			wantCharset: "utf-16be",
+			wantSource:  CharsetBOM,
+		},
+		{
+			name:         "invalid utf-8 declared",
+			body:         "ok\xff",
+			contentType:  "text/plain; charset=utf-8",
+			want:         "ok�",
+			wantCharset:  "utf-8",
+			wantSource:   CharsetHeader,
+			wantReplaced: true,
+		},
+		{
+			name:         "invalid shift_jis",
+			body:         "\x93",
+			contentType:  "text/plain; charset=shift_jis",
+			want:         "�",
+			wantCharset:  "shift_jis",
+			wantSource:   CharsetHeader,
+			wantReplaced: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DecodeText([]byte(tt.body), tt.contentType)
+			if got.Text != tt.want {
+				t.Errorf("Text = %q, want %q", got.Text, tt.want)
+			}
+			if got.Charset != tt.wantCharset || got.Source != tt.wantSource {
+				t.Errorf("charset = %s from %s, want %s from %s", got.Charset, got.Source, tt.wantCharset, tt.wantSource)
+			}
+			if got.Replaced != tt.wantReplaced {
+				t.Errorf("Replaced = %t, want %t", got.Replaced, tt.wantReplaced)
+			}
+		})
+	}
+}
+
+func TestResponse_Text(t *testing.T) {
+	resp := &Response{Rawdata: []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=iso-8859-1\r\nContent-Length: 4\r\n\r\ncaf\xe9")}
+	got := resp.Text()
+	if got.Text != "café" || got.Source != CharsetHeader {
+		t.Errorf("Text() = %+v", got)
+	}
+}
@@ -0,0 +1,289 @@
+package rawhttp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// VariableFunc computes the value of a template variable. arg is the text
+// after ':' in ||NAME:arg||, the expanded content of ||NAME(...)||, or nil
+// for a plain ||NAME||.
+type VariableFunc func(req *Request, arg []byte) []byte
+
+// Variables is a registry of user-defined template variables. It is safe
+// for concurrent use. Registered names take precedence over the built-in
+// variables, so a registry can also override them.
+//
+// The registry also holds the ||COUNTER|| counters of the requests using
+// it, so each registry counts from 1.
+type Variables struct {
+	mu    sync.RWMutex
+	funcs map[string]VariableFunc
+
+	counters sync.Map
+}
+
+func NewVariables() *Variables {
+	return &Variables{funcs: make(map[string]VariableFunc)}
+}
+
+// Set registers a variable with a fixed value.
+func (obj *Variables) Set(name string, value []byte) {
+	v := append([]byte(nil), value...)
+	obj.SetFunc(name, func(*Request, []byte) []byte { return v })
+}
+
+// SetFunc registers a variable computed on every expansion.
+func (obj *Variables) SetFunc(name string, fn VariableFunc) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	if obj.funcs == nil {
+		obj.funcs = make(map[string]VariableFunc)
+	}
+	obj.funcs[name] = fn
+}
+
+// Delete removes a variable from the registry.
+func (obj *Variables) Delete(name string) {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	delete(obj.funcs, name)
+}
+
+func (obj *Variables) lookup(name string) (VariableFunc, bool) {
+	if obj == nil {
+		return nil, false
+	}
+	obj.mu.RLock()
+	defer obj.mu.RUnlock()
+	fn, ok := obj.funcs[name]
+	return fn, ok
+}
+
+// builtinVariables are always available in templates:
+//
+//	||CR|| ||LF||                 carriage return and line feed
+//	||ABSURL|| ||HOST|| ||PORT||  parts of Request.URL
+//	||SCHEME|| ||PATH|| ||ESCAPEDPATH|| ||FULLPATH||
+//	||RANDHEX:n||                 n random bytes as hex (default 8)
+//	||UUID||                      random version 4 UUID
+//	||TIMESTAMP|| ||TIMESTAMPMS|| current Unix time in seconds or milliseconds
+//	||HTTPDATE||                  current time in IMF-fixdate format
+//	||COUNTER|| ||COUNTER:name||  counter starting at 1, see variableCounter
+//	||BASE64(...)|| ||URLENCODE(...)|| ||HEX(...)||
+//	                              transforms applied to the expanded content
+//
+// A backslash before "||" sends a literal "||". Length markers such as
+// ||CLEN|| are resolved afterwards, see ResolveLengthMarkers.
+var builtinVariables = map[string]VariableFunc{
+	"CR": func(*Request, []byte) []byte { return []byte("\r") },
+	"LF": func(*Request, []byte) []byte { return []byte("\n") },
+	"ABSURL": func(req *Request, _ []byte) []byte {
+		return []byte(req.URL)
+	},
+	"HOST": func(req *Request, _ []byte) []byte {
+		return []byte(req.URI.Hostname())
+	},
+	"PORT": func(req *Request, _ []byte) []byte {
+		return []byte(req.port())
+	},
+	"SCHEME": func(req *Request, _ []byte) []byte {
+		return []byte(req.URI.Scheme)
+	},
+	"PATH": func(req *Request, _ []byte) []byte {
+		if req.URI.Path == "" {
+			return []byte("/")
+		}
+		return []byte(req.URI.Path)
+	},
+	"ESCAPEDPATH": func(req *Request, _ []byte) []byte {
+		return []byte(req.URI.EscapedPath())
+	},
+	"FULLPATH": func(req *Request, _ []byte) []byte {
+		return []byte(req.FullPath())
+	},
+	"RANDHEX": func(_ *Request, arg []byte) []byte {
+		n, err := strconv.Atoi(string(arg))
+		if err != nil || n <= 0 {
+			n = 8
+		}
+		b := make([]byte, n)
+		rand.Read(b)
+		return []byte(hex.EncodeToString(b))
+	},
+	"UUID": func(*Request, []byte) []byte {
+		b := make([]byte, 16)
+		rand.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return []byte(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))
+	},
+	"TIMESTAMP": func(*Request, []byte) []byte {
+		return []byte(strconv.FormatInt(time.Now().Unix(), 10))
+	},
+	"TIMESTAMPMS": func(*Request, []byte) []byte {
+		return []byte(strconv.FormatInt(time.Now().UnixMilli(), 10))
+	},
+	"HTTPDATE": func(*Request, []byte) []byte {
+		return []byte(time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"))
+	},
+	"COUNTER": func(req *Request, arg []byte) []byte {
+		return []byte(strconv.FormatUint(variableCounter(req, string(arg)).Add(1), 10))
+	},
+	"BASE64": func(_ *Request, arg []byte) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(arg))
+	},
+	"URLENCODE": func(_ *Request, arg []byte) []byte {
+		return []byte(url.QueryEscape(string(arg)))
+	},
+	"HEX": func(_ *Request, arg []byte) []byte {
+		return []byte(hex.EncodeToString(arg))
+	},
+}
+
+// variableCounters holds the counters of requests without a Variables
+// registry.
+var variableCounters sync.Map
+
+// variableCounter returns the named counter of the request's registry, of
+// the client's when the request has none, and the process-wide one when
+// neither is set.
+func variableCounter(req *Request, name string) *atomic.Uint64 {
+	counters := &variableCounters
+	switch {
+	case req.variables != nil:
+		counters = &req.variables.counters
+	case req.clientVariables != nil:
+		counters = &req.clientVariables.counters
+	}
+	c, _ := counters.LoadOrStore(name, new(atomic.Uint64))
+	return c.(*atomic.Uint64)
+}
+
+var (
+	variableDelim = []byte("||")
+	variableEsc   = []byte(`\||`)
+	transformEnd  = []byte(")||")
+)
+
+// variableExpander replaces ||NAME||, ||NAME:arg|| and ||NAME(...)||
+// tokens. Unknown names are left untouched.
+type variableExpander struct {
+	req *Request
+	// keepEscapes leaves \|| in place for ResolveLengthMarkers.
+	keepEscapes bool
+	// trackEnd makes ||END|| vanish and records where it was in endAt.
+	trackEnd bool
+	endAt    int
+}
+
+// expand processes data until its end or, when nested is true, until the
+// ")||" that closes the enclosing transform. It returns the output, the
+// number of input bytes consumed including that terminator, and whether
+// the terminator was found.
+func (obj *variableExpander) expand(data []byte, nested bool) ([]byte, int, bool) {
+	var buf bytes.Buffer
+	i := 0
+	for i < len(data) {
+		rest := data[i:]
+		if bytes.HasPrefix(rest, variableEsc) {
+			if obj.keepEscapes {
+				buf.Write(variableEsc)
+			} else {
+				buf.Write(variableDelim)
+			}
+			i += len(variableEsc)
+			continue
+		}
+		if nested && bytes.HasPrefix(rest, transformEnd) {
+			return buf.Bytes(), i + len(transformEnd), true
+		}
+		if bytes.HasPrefix(rest, variableDelim) {
+			if val, n, ok := obj.token(rest, buf.Len()); ok {
+				buf.Write(val)
+				i += n
+				continue
+			}
+			buf.Write(variableDelim)
+			i += len(variableDelim)
+			continue
+		}
+		buf.WriteByte(data[i])
+		i++
+	}
+	return buf.Bytes(), i, false
+}
+
+// token parses a variable at the start of data, which begins with "||".
+func (obj *variableExpander) token(data []byte, outPos int) ([]byte, int, bool) {
+	i := len(variableDelim)
+	for i < len(data) && isVariableNameByte(data[i]) {
+		i++
+	}
+	name := string(data[len(variableDelim):i])
+	if name == "" || i >= len(data) {
+		return nil, 0, false
+	}
+
+	switch {
+	case bytes.HasPrefix(data[i:], variableDelim):
+		if obj.trackEnd && name == "END" {
+			if obj.endAt == -1 {
+				obj.endAt = outPos
+			}
+			return nil, i + len(variableDelim), true
+		}
+		fn, ok := obj.lookup(name)
+		if !ok {
+			return nil, 0, false
+		}
+		return fn(obj.req, nil), i + len(variableDelim), true
+	case data[i] == ':':
+		end := bytes.Index(data[i:], variableDelim)
+		if end == -1 {
+			return nil, 0, false
+		}
+		fn, ok := obj.lookup(name)
+		if !ok {
+			return nil, 0, false
+		}
+		return fn(obj.req, data[i+1:i+end]), i + end + len(variableDelim), true
+	case data[i] == '(':
+		fn, ok := obj.lookup(name)
+		if !ok {
+			return nil, 0, false
+		}
+		trackEnd := obj.trackEnd
+		obj.trackEnd = false
+		arg, n, closed := obj.expand(data[i+1:], true)
+		obj.trackEnd = trackEnd
+		if !closed {
+			return nil, 0, false
+		}
+		return fn(obj.req, arg), i + 1 + n, true
+	}
+	return nil, 0, false
+}
+
+func (obj *variableExpander) lookup(name string) (VariableFunc, bool) {
+	if fn, ok := obj.req.variables.lookup(name); ok {
+		return fn, true
+	}
+	if fn, ok := obj.req.clientVariables.lookup(name); ok {
+		return fn, true
+	}
+	fn, ok := builtinVariables[name]
+	return fn, ok
+}
+
+func isVariableNameByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
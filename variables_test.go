@@ -0,0 +1,200 @@
+package rawhttp
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/vodafon/rawhttp/rawhttptest"
+)
+
+// expandTestBody runs PrepareRequestVariables on a body and returns it.
+func expandTestBody(req *Request, body string) string {
+	req.body = []byte(body)
+	PrepareRequestVariables(req)
+	return string(req.body)
+}
+
+func TestExpandVariables(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		input string
+		want  string
+	}{
+		{
+			name:  "adjacent variables",
+			url:   "https://example.com/",
+			input: "a||CR||||LF||b",
+			want:  "a\r\nb",
+		},
+		{
+			name:  "port and scheme",
+			url:   "https://example.com:8443/",
+			input: "||SCHEME||://||HOST||:||PORT||",
+			want:  "https://example.com:8443",
+		},
+		{
+			name:  "default port",
+			url:   "http://example.com/",
+			input: "||PORT||",
+			want:  "80",
+		},
+		{
+			name:  "unknown variable left as is",
+			url:   "https://example.com/",
+			input: "||NOPE|| ||HOST||",
+			want:  "||NOPE|| example.com",
+		},
+		{
+			name:  "escaped delimiter",
+			url:   "https://example.com/",
+			input: `a\||HOST\||b`,
+			want:  "a||HOST||b",
+		},
+		{
+			name:  "base64 transform",
+			url:   "https://example.com/",
+			input: "||BASE64(user:pass)||",
+			want:  "dXNlcjpwYXNz",
+		},
+		{
+			name:  "nested transforms",
+			url:   "https://example.com/",
+			input: "||HEX(||URLENCODE(a b||HOST||)||)||",
+			want:  "612b626578616d706c652e636f6d",
+		},
+		{
+			name:  "unterminated transform",
+			url:   "https://example.com/",
+			input: "||BASE64(abc",
+			want:  "||BASE64(abc",
+		},
+		{
+			name:  "pipes inside transform",
+			url:   "https://example.com/",
+			input: "||URLENCODE(a|b)||",
+			want:  "a%7Cb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{URL: tt.url}
+			req.URI, _ = parseTestURL(tt.url)
+
+			if got := string(expandTestBody(req, tt.input)); got != tt.want {
+				t.Errorf("expanded = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandVariables_Dynamic(t *testing.T) {
+	req := &Request{URL: "https://example.com/"}
+	req.URI, _ = parseTestURL(req.URL)
+
+	tests := []struct {
+		input string
+		re    string
+	}{
+		{"||RANDHEX:4||", `^[0-9a-f]{8}$`},
+		{"||RANDHEX||", `^[0-9a-f]{16}$`},
+		{"||UUID||", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"||TIMESTAMP||", `^\d{10}$`},
+		{"||TIMESTAMPMS||", `^\d{13}$`},
+		{"||HTTPDATE||", `^[A-Z][a-z]{2}, \d{2} [A-Z][a-z]{2} \d{4} \d{2}:\d{2}:\d{2} GMT$`},
+	}
+
+	for _, tt := range tests {
+		got := string(expandTestBody(req, tt.input))
+		if !regexp.MustCompile(tt.re).MatchString(got) {
+			t.Errorf("%s = %q, want match %s", tt.input, got, tt.re)
+		}
+	}
+
+	if a, b := expandTestBody(req, "||RANDHEX||"), expandTestBody(req, "||RANDHEX||"); a == b {
+		t.Error("RANDHEX returned the same value twice")
+	}
+
+	req.SetVariables(NewVariables())
+	first := expandTestBody(req, "||COUNTER:test-counter||")
+	second := expandTestBody(req, "||COUNTER:test-counter||")
+	if first != "1" || second != "2" {
+		t.Errorf("COUNTER = %q, %q, want 1, 2", first, second)
+	}
+
+	// counters belong to the registry
+	other := &Request{URL: req.URL, URI: req.URI, clientVariables: NewVariables()}
+	if got := expandTestBody(other, "||COUNTER:test-counter||"); got != "1" {
+		t.Errorf("COUNTER of another registry = %q, want 1", got)
+	}
+}
+
+func TestVariables_Precedence(t *testing.T) {
+	clientVars := NewVariables()
+	clientVars.Set("TOKEN", []byte("client"))
+	clientVars.Set("HOST", []byte("override.example"))
+	clientVars.Set("ONLYCLIENT", []byte("c"))
+
+	reqVars := NewVariables()
+	reqVars.Set("TOKEN", []byte("request"))
+	reqVars.SetFunc("UPPER", func(_ *Request, arg []byte) []byte {
+		return []byte(strings.ToUpper(string(arg)))
+	})
+
+	req := &Request{URL: "https://example.com/", clientVariables: clientVars}
+	req.URI, _ = parseTestURL(req.URL)
+	req.SetVariables(reqVars)
+
+	got := expandTestBody(req, "||TOKEN|| ||HOST|| ||ONLYCLIENT|| ||UPPER:abc|| ||UPPER(||TOKEN||)||")
+	want := "request override.example c ABC REQUEST"
+	if got != want {
+		t.Errorf("expanded = %q, want %q", got, want)
+	}
+
+	reqVars.Delete("TOKEN")
+	if got := expandTestBody(req, "||TOKEN||"); got != "client" {
+		t.Errorf("after Delete = %q, want %q", got, "client")
+	}
+}
+
+func TestPrepareRequestVariables_End(t *testing.T) {
+	req := &Request{
+		URL:  "https://example.com/",
+		body: []byte("keep||BASE64(||END||)||||END||drop||END||"),
+	}
+	req.URI, _ = parseTestURL(req.URL)
+
+	PrepareRequestVariables(req)
+
+	// ||END|| inside a transform is not a truncation point.
+	if want := "keepfHxFTkR8fA=="; string(req.body) != want {
+		t.Errorf("body = %q, want %q", req.body, want)
+	}
+}
+
+func TestClient_SetVariable(t *testing.T) {
+	srv := rawhttptest.NewServer(rawhttptest.Script{
+		rawhttptest.ExpectRequest(),
+		rawhttptest.Write("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+	})
+	defer srv.Close()
+
+	client := NewClientTransferVariables()
+	defer client.Close()
+	client.SetVariable("SESSION", []byte("abc123"))
+	client.SetVariableFunc("ECHO", func(_ *Request, arg []byte) []byte { return arg })
+
+	req := &Request{
+		Rawdata: []byte("GET / HTTP/1.1\r\nHost: ||HOST||\r\nCookie: s=||SESSION||; e=||ECHO:x||\r\n\r\n"),
+		URL:     srv.URL + "/",
+	}
+	if err := client.Do(req, client.NewResponse()); err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+
+	if got := string(srv.Conn(0).Received()); !strings.Contains(got, "Cookie: s=abc123; e=x\r\n") {
+		t.Errorf("server received %q", got)
+	}
+}